@@ -1,931 +1,171 @@
 package batchedrand
 
-import (
-	"math/bits"
-	"math/rand/v2"
-)
+import "math/rand/v2"
 
+// Rand is a source of random numbers whose Shuffle method uses the batched
+// algorithm. The embedded *rand.Rand provides every other method.
 type Rand struct {
 	*rand.Rand
+	// src is the source of Rand, when known. It lets Shuffle draw words
+	// from src directly rather than through *rand.Rand, and call the
+	// Uint64 method of known sources without going through an interface.
+	src rand.Source
+	// levels are the batch levels set by SetThresholds, if any.
+	levels []batchLevel
 }
 
-// Shuffle pseudo-randomizes the order of elements.
-// n is the number of elements. Shuffle panics if n < 0.
-// swap swaps the elements with indexes i and j.
-func (r *Rand) Shuffle(n int, swap func(i, j int)) {
-	if n < 0 {
-		panic("invalid argument to Shuffle")
-	}
-	i := uint64(n)
+// New returns a new Rand that uses random values from src. It is the
+// constructor of Rand: as Rand has unexported fields, unkeyed literals
+// such as Rand{rand.New(src)} do not compile. A Rand{Rand: r} literal
+// works, but its Shuffle draws every word through r and an interface call:
+// BenchmarkSourceDispatch shows it 20% to 35% slower with PCG and ChaCha8.
+func New(src rand.Source) *Rand {
+	return &Rand{Rand: rand.New(src), src: src}
+}
 
-	// Single swaps for sizes > 2^30
-	for ; i > (1 << 30); i-- {
-		var index0 uint64
-		randVal := r.Uint64()
-		size := i
-		bound := i
-		// Unroll loop for k=1
-		a := size
-		hi, lo := bits.Mul64(a, randVal)
-		randVal = lo
-		index0 = hi
-		if randVal < bound {
-			newBound := size
-			t := (-newBound) % newBound
-			for randVal < t {
-				randVal = r.Uint64()
-				a = size
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=1
-		pos1 := size - 1
-		pos2 := index0
-		swap(int(pos1), int(pos2))
+// shuffleSource returns the source from which Shuffle draws its words, and
+// its batch levels.
+func (r *Rand) shuffleSource() (rand.Source, []batchLevel) {
+	src := r.src
+	if src == nil {
+		src = r.Rand
 	}
-
-	// Batches of 2 down to 2^19
-	for ; i > (1 << 19); i -= 2 {
-		// Inline partialShuffle64b(storage, i, 2, bound, rng)
-		var index0, index1 uint64
-		randVal := r.Uint64()
-		size := i
-		bound := uint64(1) << 60
-		// Unroll loop for k=2
-		a := size - 1
-		hi, lo := bits.Mul64(a, randVal)
-		randVal = lo
-		index1 = hi
-		a = size
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index0 = hi
-		if randVal < bound {
-			newBound := size * (size - 1)
-			t := (-newBound) % newBound
-			for randVal < t {
-				randVal = r.Uint64()
-				a = size - 1
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index1 = hi
-				a = size
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=2
-		pos1 := size - 2
-		pos2 := index1
-		swap(int(pos1), int(pos2))
-		pos1 = size - 1
-		pos2 = index0
-		swap(int(pos1), int(pos2))
+	if r.levels != nil {
+		return src, r.levels
 	}
-
-	// Batches of 3 down to 2^14
-	for ; i > (1 << 14); i -= 3 {
-		// Inline partialShuffle64b(storage, i, 3, bound, rng)
-		var index0, index1, index2 uint64
-		randVal := r.Uint64()
-		size := i
-		bound := uint64(1) << 57
-		// Unroll loop for k=3
-		a := size - 2
-		hi, lo := bits.Mul64(a, randVal)
-		randVal = lo
-		index2 = hi
-		a = size - 1
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index1 = hi
-		a = size
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index0 = hi
-		if randVal < bound {
-			newBound := size * (size - 1) * (size - 2)
-			t := (-newBound) % newBound
-			for randVal < t {
-				randVal = r.Uint64()
-				a = size - 2
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index2 = hi
-				a = size - 1
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index1 = hi
-				a = size
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=3
-		pos1 := size - 3
-		pos2 := index2
-		swap(int(pos1), int(pos2))
-		pos1 = size - 2
-		pos2 = index1
-		swap(int(pos1), int(pos2))
-		pos1 = size - 1
-		pos2 = index0
-		swap(int(pos1), int(pos2))
+	if _, ok := src.(*secureSource); ok {
+		// Words are expensive enough for the longer batches to pay off.
+		return src, wideBatchLevels64
 	}
+	return src, batchLevels64
+}
 
-	// Batches of 4 down to 2^11
-	for ; i > (1 << 11); i -= 4 {
-		// Inline partialShuffle64b(storage, i, 4, bound, rng)
-		var index0, index1, index2, index3 uint64
-		randVal := r.Uint64()
-		size := i
-		bound := uint64(1) << 56
-		// Unroll loop for k=4
-		a := size - 3
-		hi, lo := bits.Mul64(a, randVal)
-		randVal = lo
-		index3 = hi
-		a = size - 2
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index2 = hi
-		a = size - 1
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index1 = hi
-		a = size
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index0 = hi
-		if randVal < bound {
-			newBound := size * (size - 1) * (size - 2) * (size - 3)
-			t := (-newBound) % newBound
-			for randVal < t {
-				randVal = r.Uint64()
-				a = size - 3
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index3 = hi
-				a = size - 2
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index2 = hi
-				a = size - 1
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index1 = hi
-				a = size
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=4
-		pos1 := size - 4
-		pos2 := index3
-		swap(int(pos1), int(pos2))
-		pos1 = size - 3
-		pos2 = index2
-		swap(int(pos1), int(pos2))
-		pos1 = size - 2
-		pos2 = index1
-		swap(int(pos1), int(pos2))
-		pos1 = size - 1
-		pos2 = index0
-		swap(int(pos1), int(pos2))
-	}
+// uint64Source is the method of a random source that shuffles use.
+type uint64Source interface {
+	Uint64() uint64
+}
 
-	// Batches of 5 down to 2^9
-	for ; i > (1 << 9); i -= 5 {
-		// Inline partialShuffle64b(storage, i, 5, bound, rng)
-		var index0, index1, index2, index3, index4 uint64
-		randVal := r.Uint64()
-		size := i
-		bound := uint64(1) << 55
-		// Unroll loop for k=5
-		a := size - 4
-		hi, lo := bits.Mul64(a, randVal)
-		randVal = lo
-		index4 = hi
-		a = size - 3
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index3 = hi
-		a = size - 2
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index2 = hi
-		a = size - 1
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index1 = hi
-		a = size
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index0 = hi
-		if randVal < bound {
-			newBound := size * (size - 1) * (size - 2) * (size - 3) * (size - 4)
-			t := (-newBound) % newBound
-			for randVal < t {
-				randVal = r.Uint64()
-				a = size - 4
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index4 = hi
-				a = size - 3
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index3 = hi
-				a = size - 2
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index2 = hi
-				a = size - 1
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index1 = hi
-				a = size
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=5
-		pos1 := size - 5
-		pos2 := index4
-		swap(int(pos1), int(pos2))
-		pos1 = size - 4
-		pos2 = index3
-		swap(int(pos1), int(pos2))
-		pos1 = size - 3
-		pos2 = index2
-		swap(int(pos1), int(pos2))
-		pos1 = size - 2
-		pos2 = index1
-		swap(int(pos1), int(pos2))
-		pos1 = size - 1
-		pos2 = index0
-		swap(int(pos1), int(pos2))
-	}
+// funcSource adapts a function to uint64Source.
+type funcSource func() uint64
 
-	// Batches of 6 down to 6
-	for ; i > 6; i -= 6 {
-		// Inline partialShuffle64b(storage, i, 6, bound, rng)
-		var index0, index1, index2, index3, index4, index5 uint64
-		randVal := r.Uint64()
-		size := i
-		bound := uint64(1) << 54
-		// Unroll loop for k=6
-		a := size - 5
-		hi, lo := bits.Mul64(a, randVal)
-		randVal = lo
-		index5 = hi
-		a = size - 4
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index4 = hi
-		a = size - 3
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index3 = hi
-		a = size - 2
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index2 = hi
-		a = size - 1
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index1 = hi
-		a = size
-		hi, lo = bits.Mul64(a, randVal)
-		randVal = lo
-		index0 = hi
-		if randVal < bound {
-			newBound := size * (size - 1) * (size - 2) * (size - 3) * (size - 4) * (size - 5)
-			t := (-newBound) % newBound
-			for randVal < t {
-				randVal = r.Uint64()
-				a = size - 5
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index5 = hi
-				a = size - 4
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index4 = hi
-				a = size - 3
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index3 = hi
-				a = size - 2
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index2 = hi
-				a = size - 1
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index1 = hi
-				a = size
-				hi, lo = bits.Mul64(a, randVal)
-				randVal = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=6
-		pos1 := size - 6
-		pos2 := index5
-		swap(int(pos1), int(pos2))
-		pos1 = size - 5
-		pos2 = index4
-		swap(int(pos1), int(pos2))
-		pos1 = size - 4
-		pos2 = index3
-		swap(int(pos1), int(pos2))
-		pos1 = size - 3
-		pos2 = index2
-		swap(int(pos1), int(pos2))
-		pos1 = size - 2
-		pos2 = index1
-		swap(int(pos1), int(pos2))
-		pos1 = size - 1
-		pos2 = index0
-		swap(int(pos1), int(pos2))
+func (f funcSource) Uint64() uint64 {
+	return f()
+}
+
+// Shuffle pseudo-randomizes the order of elements.
+// n is the number of elements. Shuffle panics if n < 0.
+// swap swaps the elements with indexes i and j.
+func (r *Rand) Shuffle(n int, swap func(i, j int)) {
+	if n < 0 {
+		panic("invalid argument to Shuffle")
 	}
+	src, levels := r.shuffleSource()
+	shuffle(src, n, levels, swap)
+}
 
-	// Final small shuffle if anything remains (i <= 6)
-	if i > 1 {
-		// For remaining i elements, we need to shuffle the last (i-1) positions.
-		// 720 = 6! is a safe bound that works for i <= 7.
-		// Inline partialShuffle64b(storage, i, i-1, 720, rng)
-		var index0, index1, index2, index3, index4 uint64
-		randVal := r.Uint64()
-		size := i
-		k := i - 1
-		bound := uint64(720)
-		// Unroll loop for k = i-1, but since i <=6, k<=5, we can handle cases
-		// For simplicity, since k varies, we'll use a switch based on k
-		var a, hi, lo uint64
-		switch k {
-		case 5:
-			a = size - 4
-			hi, lo = bits.Mul64(a, randVal)
-			randVal = lo
-			index4 = hi
-			fallthrough
-		case 4:
-			a = size - 3
-			hi, lo = bits.Mul64(a, randVal)
-			randVal = lo
-			index3 = hi
-			fallthrough
-		case 3:
-			a = size - 2
-			hi, lo = bits.Mul64(a, randVal)
-			randVal = lo
-			index2 = hi
-			fallthrough
-		case 2:
-			a = size - 1
-			hi, lo = bits.Mul64(a, randVal)
-			randVal = lo
-			index1 = hi
-			fallthrough
-		case 1:
-			a = size
-			hi, lo = bits.Mul64(a, randVal)
-			randVal = lo
-			index0 = hi
-		}
-		if randVal < bound {
-			newBound := uint64(1)
-			for j := uint64(1); j < k; j++ {
-				newBound *= size - j
-			}
-			t := (-newBound) % newBound
-			for randVal < t {
-				randVal = r.Uint64()
-				switch k {
-				case 5:
-					a = size - 4
-					hi, lo = bits.Mul64(a, randVal)
-					randVal = lo
-					index4 = hi
-					fallthrough
-				case 4:
-					a = size - 3
-					hi, lo = bits.Mul64(a, randVal)
-					randVal = lo
-					index3 = hi
-					fallthrough
-				case 3:
-					a = size - 2
-					hi, lo = bits.Mul64(a, randVal)
-					randVal = lo
-					index2 = hi
-					fallthrough
-				case 2:
-					a = size - 1
-					hi, lo = bits.Mul64(a, randVal)
-					randVal = lo
-					index1 = hi
-					fallthrough
-				case 1:
-					a = size
-					hi, lo = bits.Mul64(a, randVal)
-					randVal = lo
-					index0 = hi
-				}
-			}
-		}
-		// Unroll swaps based on k
-		var pos1, pos2 uint64
-		switch k {
-		case 5:
-			pos1 = size - 5
-			pos2 = index4
-			swap(int(pos1), int(pos2))
-			fallthrough
-		case 4:
-			pos1 = size - 4
-			pos2 = index3
-			swap(int(pos1), int(pos2))
-			fallthrough
-		case 3:
-			pos1 = size - 3
-			pos2 = index2
-			swap(int(pos1), int(pos2))
-			fallthrough
-		case 2:
-			pos1 = size - 2
-			pos2 = index1
-			swap(int(pos1), int(pos2))
-			fallthrough
-		case 1:
-			pos1 = size - 1
-			pos2 = index0
-			swap(int(pos1), int(pos2))
-		}
+// shuffle implements Shuffle, with the given batch levels below 2^30: it
+// calls swap(i, j) once for each i from n-1 down to 1, with j uniform in
+// [0, i] and independent of the other calls. Go compiles a single
+// instance of shuffle for all pointer types, which calls their Uint64
+// methods indirectly: shuffleLevels, which draws nearly all the words,
+// dispatches known sources to kernels of their own.
+func shuffle[S uint64Source](r S, n int, levels []batchLevel, swap func(i, j int)) {
+	if n <= maxWordShuffle {
+		if n > 1 {
+			shuffleWord(r, n, swap)
+		}
+		return
 	}
+	shuffleLevels(r, shuffleAbove(r, uint64(n), levels[0].max, swap), levels, swap)
 }
 
-func shuffleBatch23456(storage []int, rng func() uint64) {
-	i := uint64(len(storage))
+// swapIndex is the type of the indexes of a swap callback: int for
+// Shuffle, uint64 for Shuffle64.
+type swapIndex interface {
+	int | uint64
+}
 
-	// Single swaps for sizes > 2^30
-	for ; i > (1 << 30); i-- {
-		var index0 uint64
-		r := rng()
-		n := i
-		bound := i
-		// Unroll loop for k=1
-		a := n
-		hi, lo := bits.Mul64(a, r)
-		r = lo
-		index0 = hi
-		if r < bound {
-			newBound := n
-			t := (-newBound) % newBound
-			for r < t {
-				r = rng()
-				a = n
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=1
-		pos1 := n - 1
-		pos2 := index0
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-	}
+// shuffleAbove performs the swaps of shuffle while more than limit elements
+// remain, and returns the number of remaining elements: min(n, limit).
+func shuffleAbove[S uint64Source, I swapIndex](r S, n, limit uint64, swap func(i, j I)) uint64 {
+	i := n
+	var indexes [maxBatch]uint64
 
-	// Batches of 2 down to 2^19
-	for ; i > (1 << 19); i -= 2 {
-		// Inline partialShuffle64b(storage, i, 2, bound, rng)
-		var index0, index1 uint64
-		r := rng()
-		n := i
-		bound := uint64(1) << 60
-		// Unroll loop for k=2
-		a := n - 1
-		hi, lo := bits.Mul64(a, r)
-		r = lo
-		index1 = hi
-		a = n
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index0 = hi
-		if r < bound {
-			newBound := n * (n - 1)
-			t := (-newBound) % newBound
-			for r < t {
-				r = rng()
-				a = n - 1
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index1 = hi
-				a = n
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=2
-		pos1 := n - 2
-		pos2 := index1
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 1
-		pos2 = index0
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
+	// Single swaps for sizes > 2^40
+	for ; i > (1 << 40); i-- {
+		drawBatch(r, i, 1, i, &indexes)
+		swap(I(i-1), I(indexes[0]))
 	}
 
-	// Batches of 3 down to 2^14
-	for ; i > (1 << 14); i -= 3 {
-		// Inline partialShuffle64b(storage, i, 3, bound, rng)
-		var index0, index1, index2 uint64
-		r := rng()
-		n := i
-		bound := uint64(1) << 57
-		// Unroll loop for k=3
-		a := n - 2
-		hi, lo := bits.Mul64(a, r)
-		r = lo
-		index2 = hi
-		a = n - 1
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index1 = hi
-		a = n
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index0 = hi
-		if r < bound {
-			newBound := n * (n - 1) * (n - 2)
-			t := (-newBound) % newBound
-			for r < t {
-				r = rng()
-				a = n - 2
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index2 = hi
-				a = n - 1
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index1 = hi
-				a = n
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=3
-		pos1 := n - 3
-		pos2 := index2
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 2
-		pos2 = index1
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 1
-		pos2 = index0
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
+	// Batches of 3 from two random words down to 2^30
+	for ; i > limit; i -= 3 {
+		batchedIndices128(r, i, indexes[:3])
+		swap(I(i-1), I(indexes[0]))
+		swap(I(i-2), I(indexes[1]))
+		swap(I(i-3), I(indexes[2]))
 	}
+	return i
+}
 
-	// Batches of 4 down to 2^11
-	for ; i > (1 << 11); i -= 4 {
-		// Inline partialShuffle64b(storage, i, 4, bound, rng)
-		var index0, index1, index2, index3 uint64
-		r := rng()
-		n := i
-		bound := uint64(1) << 56
-		// Unroll loop for k=4
-		a := n - 3
-		hi, lo := bits.Mul64(a, r)
-		r = lo
-		index3 = hi
-		a = n - 2
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index2 = hi
-		a = n - 1
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index1 = hi
-		a = n
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index0 = hi
-		if r < bound {
-			newBound := n * (n - 1) * (n - 2) * (n - 3)
-			t := (-newBound) % newBound
-			for r < t {
-				r = rng()
-				a = n - 3
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index3 = hi
-				a = n - 2
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index2 = hi
-				a = n - 1
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index1 = hi
-				a = n
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index0 = hi
+// shuffleLevels performs the swaps of the batched algorithm for the first
+// n <= levels[0].max elements. It calls the generated kernel of the source,
+// for a *rand.PCG, a *rand.ChaCha8 or a Buffered, and the generic one
+// otherwise.
+func shuffleLevels[S uint64Source](r S, n uint64, levels []batchLevel, swap func(i, j int)) {
+	for _, level := range levels {
+		if n <= level.threshold {
+			continue
+		}
+		dual := n > dualStreamThreshold
+		switch src := any(r).(type) {
+		case *rand.PCG:
+			if dual {
+				n = shuffleLevelPCGDual(src, n, level, swap)
+			} else {
+				n = shuffleLevelPCG(src, n, level, swap)
+			}
+		case *rand.ChaCha8:
+			if dual {
+				n = shuffleLevelChaCha8Dual(src, n, level, swap)
+			} else {
+				n = shuffleLevelChaCha8(src, n, level, swap)
+			}
+		case *Buffered:
+			if dual {
+				n = shuffleLevelBufferedDual(src, n, level, swap)
+			} else {
+				n = shuffleLevelBuffered(src, n, level, swap)
+			}
+		default:
+			if dual {
+				n = shuffleLevelDual(r, n, level, swap)
+			} else {
+				n = shuffleLevel(r, n, level, swap)
 			}
 		}
-		// Unroll swaps for k=4
-		pos1 := n - 4
-		pos2 := index3
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 3
-		pos2 = index2
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 2
-		pos2 = index1
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 1
-		pos2 = index0
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
 	}
+}
 
-	// Batches of 5 down to 2^9
-	for ; i > (1 << 9); i -= 5 {
-		// Inline partialShuffle64b(storage, i, 5, bound, rng)
-		var index0, index1, index2, index3, index4 uint64
-		r := rng()
-		n := i
-		bound := uint64(1) << 55
-		// Unroll loop for k=5
-		a := n - 4
-		hi, lo := bits.Mul64(a, r)
-		r = lo
-		index4 = hi
-		a = n - 3
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index3 = hi
-		a = n - 2
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index2 = hi
-		a = n - 1
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index1 = hi
-		a = n
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index0 = hi
-		if r < bound {
-			newBound := n * (n - 1) * (n - 2) * (n - 3) * (n - 4)
-			t := (-newBound) % newBound
-			for r < t {
-				r = rng()
-				a = n - 4
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index4 = hi
-				a = n - 3
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index3 = hi
-				a = n - 2
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index2 = hi
-				a = n - 1
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index1 = hi
-				a = n
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=5
-		pos1 := n - 5
-		pos2 := index4
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 4
-		pos2 = index3
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 3
-		pos2 = index2
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 2
-		pos2 = index1
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 1
-		pos2 = index0
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
+// shuffleSlice is shuffle for the elements of s, which the kernels of the
+// batch levels swap directly rather than through a callback.
+func shuffleSlice[S uint64Source, T any](r S, s []T, levels []batchLevel) {
+	swap := func(i, j int) {
+		s[i], s[j] = s[j], s[i]
 	}
-
-	// Batches of 6 down to 6
-	for ; i > 6; i -= 6 {
-		// Inline partialShuffle64b(storage, i, 6, bound, rng)
-		var index0, index1, index2, index3, index4, index5 uint64
-		r := rng()
-		n := i
-		bound := uint64(1) << 54
-		// Unroll loop for k=6
-		a := n - 5
-		hi, lo := bits.Mul64(a, r)
-		r = lo
-		index5 = hi
-		a = n - 4
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index4 = hi
-		a = n - 3
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index3 = hi
-		a = n - 2
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index2 = hi
-		a = n - 1
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index1 = hi
-		a = n
-		hi, lo = bits.Mul64(a, r)
-		r = lo
-		index0 = hi
-		if r < bound {
-			newBound := n * (n - 1) * (n - 2) * (n - 3) * (n - 4) * (n - 5)
-			t := (-newBound) % newBound
-			for r < t {
-				r = rng()
-				a = n - 5
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index5 = hi
-				a = n - 4
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index4 = hi
-				a = n - 3
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index3 = hi
-				a = n - 2
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index2 = hi
-				a = n - 1
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index1 = hi
-				a = n
-				hi, lo = bits.Mul64(a, r)
-				r = lo
-				index0 = hi
-			}
-		}
-		// Unroll swaps for k=6
-		pos1 := n - 6
-		pos2 := index5
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 5
-		pos2 = index4
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 4
-		pos2 = index3
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 3
-		pos2 = index2
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 2
-		pos2 = index1
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		pos1 = n - 1
-		pos2 = index0
-		storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
+	if len(s) <= maxWordShuffle {
+		shuffle(r, len(s), levels, swap)
+		return
 	}
-
-	// Final small shuffle if anything remains (i <= 6)
-	if i > 1 {
-		// For remaining i elements, we need to shuffle the last (i-1) positions.
-		// 720 = 6! is a safe bound that works for i <= 7.
-		// Inline partialShuffle64b(storage, i, i-1, 720, rng)
-		var index0, index1, index2, index3, index4 uint64
-		r := rng()
-		n := i
-		k := i - 1
-		bound := uint64(720)
-		// Unroll loop for k = i-1, but since i <=6, k<=5, we can handle cases
-		// For simplicity, since k varies, we'll use a switch based on k
-		var a, hi, lo uint64
-		switch k {
-		case 5:
-			a = n - 4
-			hi, lo = bits.Mul64(a, r)
-			r = lo
-			index4 = hi
-			fallthrough
-		case 4:
-			a = n - 3
-			hi, lo = bits.Mul64(a, r)
-			r = lo
-			index3 = hi
-			fallthrough
-		case 3:
-			a = n - 2
-			hi, lo = bits.Mul64(a, r)
-			r = lo
-			index2 = hi
-			fallthrough
-		case 2:
-			a = n - 1
-			hi, lo = bits.Mul64(a, r)
-			r = lo
-			index1 = hi
-			fallthrough
-		case 1:
-			a = n
-			hi, lo = bits.Mul64(a, r)
-			r = lo
-			index0 = hi
-		}
-		if r < bound {
-			newBound := uint64(1)
-			for j := uint64(1); j < k; j++ {
-				newBound *= n - j
-			}
-			t := (-newBound) % newBound
-			for r < t {
-				r = rng()
-				switch k {
-				case 5:
-					a = n - 4
-					hi, lo = bits.Mul64(a, r)
-					r = lo
-					index4 = hi
-					fallthrough
-				case 4:
-					a = n - 3
-					hi, lo = bits.Mul64(a, r)
-					r = lo
-					index3 = hi
-					fallthrough
-				case 3:
-					a = n - 2
-					hi, lo = bits.Mul64(a, r)
-					r = lo
-					index2 = hi
-					fallthrough
-				case 2:
-					a = n - 1
-					hi, lo = bits.Mul64(a, r)
-					r = lo
-					index1 = hi
-					fallthrough
-				case 1:
-					a = n
-					hi, lo = bits.Mul64(a, r)
-					r = lo
-					index0 = hi
-				}
-			}
+	n := shuffleAbove(r, uint64(len(s)), levels[0].max, swap)
+	for _, level := range levels {
+		if n > dualStreamThreshold {
+			n = shuffleLevelSliceDual(r, n, level, s)
+		} else if n > level.threshold {
+			n = shuffleLevelSlice(r, n, level, s)
 		}
-		// Unroll swaps based on k
-		var pos1, pos2 uint64
-		switch k {
-		case 5:
-			pos1 = n - 5
-			pos2 = index4
-			storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-			fallthrough
-		case 4:
-			pos1 = n - 4
-			pos2 = index3
-			storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-			fallthrough
-		case 3:
-			pos1 = n - 3
-			pos2 = index2
-			storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-			fallthrough
-		case 2:
-			pos1 = n - 2
-			pos2 = index1
-			storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-			fallthrough
-		case 1:
-			pos1 = n - 1
-			pos2 = index0
-			storage[pos1], storage[pos2] = storage[pos2], storage[pos1]
-		}
-		// bound not used
 	}
 }
+
+func shuffleBatch23456(storage []int, rng func() uint64) {
+	shuffleSlice(funcSource(rng), storage, batchLevels64)
+}
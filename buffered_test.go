@@ -0,0 +1,71 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestBuffered_SameSequence(t *testing.T) {
+	sources := map[string]func() rand.Source{
+		"ChaCha": func() rand.Source { return rand.NewChaCha8([32]byte{1, 2, 3}) },
+		"PCG":    func() rand.Source { return rand.NewPCG(1, 2) },
+		"Rand":   func() rand.Source { return rand.New(rand.NewPCG(3, 4)) },
+	}
+	for name, newSource := range sources {
+		direct := newSource()
+		buffered := NewBuffered(newSource())
+		for i := 0; i < 3*bufferedWords+5; i++ {
+			if x, y := direct.Uint64(), buffered.Uint64(); x != y {
+				t.Fatalf("%s: word %d is %d, expected %d", name, i, y, x)
+			}
+		}
+	}
+}
+
+func TestBuffered_Shuffle(t *testing.T) {
+	// Shuffling through a Buffered source gives the same result as
+	// shuffling with the wrapped source, with two batches in flight too.
+	for _, size := range []int{30, 100, 5000, dualStreamThreshold + 1001} {
+		a, b := getSlice(size), getSlice(size)
+		New(rand.NewPCG(1, 2)).Shuffle(size, func(i, j int) {
+			a[i], a[j] = a[j], a[i]
+		})
+		New(NewBuffered(rand.NewPCG(1, 2))).Shuffle(size, func(i, j int) {
+			b[i], b[j] = b[j], b[i]
+		})
+		if !slices.Equal(a, b) {
+			t.Fatalf("size %d: buffered shuffle differs from direct shuffle", size)
+		}
+	}
+}
+
+func BenchmarkBuffered(b *testing.B) {
+	sources := map[string]func() rand.Source{
+		"ChaCha": func() rand.Source { return rand.NewChaCha8([32]byte{1, 2, 3}) },
+		"PCG":    func() rand.Source { return rand.NewPCG(1, 2) },
+	}
+	for _, name := range []string{"ChaCha", "PCG"} {
+		for _, size := range []int{30, 100, 500000} {
+			b.Run(fmt.Sprintf("%s/Unbuffered_size_%d", name, size), func(b *testing.B) {
+				rng := New(sources[name]())
+				data := getSlice(size)
+				for i := 0; i < b.N; i++ {
+					rng.Shuffle(len(data), func(i, j int) {
+						data[i], data[j] = data[j], data[i]
+					})
+				}
+			})
+			b.Run(fmt.Sprintf("%s/Buffered_size_%d", name, size), func(b *testing.B) {
+				rng := New(NewBuffered(sources[name]()))
+				data := getSlice(size)
+				for i := 0; i < b.N; i++ {
+					rng.Shuffle(len(data), func(i, j int) {
+						data[i], data[j] = data[j], data[i]
+					})
+				}
+			})
+		}
+	}
+}
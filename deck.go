@@ -0,0 +1,90 @@
+package batchedrand
+
+// Deck holds a collection of items and deals them one at a time without
+// replacement. Only the Fisher-Yates steps needed for the items actually
+// drawn are performed, and several positions are still derived from each
+// random word, as in Shuffle. Once every item has been dealt, the next
+// draw reshuffles the whole deck (the "7-bag" used by many games).
+//
+// A Deck is not safe for concurrent use.
+type Deck[T any] struct {
+	r     *Rand
+	items []T // items[:remaining] are undealt
+	// remaining is the number of undealt items.
+	remaining int
+	// pending[next:count] are buffered positions: pending[next] is uniform
+	// in [0, remaining), pending[next+1] in [0, remaining-1), and so on.
+	pending     [MaxDistinct]uint64
+	next, count int
+}
+
+// NewDeck returns a deck holding a copy of items, all of them undealt.
+func NewDeck[T any](r *Rand, items []T) *Deck[T] {
+	d := &Deck[T]{r: r, items: append([]T(nil), items...)}
+	d.remaining = len(d.items)
+	return d
+}
+
+// Len returns the total number of items in the deck, dealt or not.
+func (d *Deck[T]) Len() int {
+	return len(d.items)
+}
+
+// Remaining returns the number of items that can be drawn before the deck
+// is reshuffled.
+func (d *Deck[T]) Remaining() int {
+	return d.remaining
+}
+
+// Draw deals one item chosen uniformly among the undealt items. If every
+// item has been dealt, the deck is first reset. Draw panics if the deck
+// holds no items.
+func (d *Deck[T]) Draw() T {
+	if d.remaining == 0 {
+		if len(d.items) == 0 {
+			panic("Draw from empty Deck")
+		}
+		d.Reset()
+	}
+	if d.next == d.count {
+		k := min(batchSize(uint64(d.remaining)), d.remaining)
+		d.r.batchedIndices(uint64(d.remaining), d.pending[:k])
+		d.next, d.count = 0, k
+	}
+	j := int(d.pending[d.next])
+	d.next++
+	d.remaining--
+	d.items[j], d.items[d.remaining] = d.items[d.remaining], d.items[j]
+	return d.items[d.remaining]
+}
+
+// DrawN deals n items, in the order they were drawn, reshuffling as needed
+// if n exceeds Remaining. It panics if n < 0, or if n > 0 and the deck
+// holds no items.
+func (d *Deck[T]) DrawN(n int) []T {
+	if n < 0 {
+		panic("invalid argument to DrawN")
+	}
+	out := make([]T, n)
+	for i := range out {
+		out[i] = d.Draw()
+	}
+	return out
+}
+
+// Return puts the most recently dealt item back among the undealt items.
+// Repeated calls return dealt items in reverse order of dealing. Return
+// panics if no item is currently dealt.
+func (d *Deck[T]) Return() {
+	if d.remaining == len(d.items) {
+		panic("Return to full Deck")
+	}
+	d.remaining++
+	d.next, d.count = 0, 0
+}
+
+// Reset returns every dealt item to the deck.
+func (d *Deck[T]) Reset() {
+	d.remaining = len(d.items)
+	d.next, d.count = 0, 0
+}
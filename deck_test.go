@@ -0,0 +1,88 @@
+package batchedrand
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestDeck_DealsEachItemOncePerCycle(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	for _, size := range []int{1, 2, 7, 100, 1000} {
+		deck := NewDeck(rng, getSlice(size))
+		for cycle := 0; cycle < 3; cycle++ {
+			got := deck.DrawN(size)
+			if deck.Remaining() != 0 {
+				t.Fatalf("size %d: %d remaining, expected 0", size, deck.Remaining())
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, getSlice(size)) {
+				t.Fatalf("size %d: cycle %d did not deal every item once", size, cycle)
+			}
+		}
+	}
+}
+
+func TestDeck_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	// Every order of a four-item deck should be equally likely, including
+	// across automatic reshuffles.
+	deck := NewDeck(rng, []int{0, 1, 2, 3})
+	const numDeals = 24 * 4000
+	counts := make(map[[4]int]int)
+	for i := 0; i < numDeals; i++ {
+		counts[[4]int{deck.Draw(), deck.Draw(), deck.Draw(), deck.Draw()}]++
+	}
+	if len(counts) != 24 {
+		t.Fatalf("saw %d orders, expected 24", len(counts))
+	}
+	for order, c := range counts {
+		if c < 3600 || c > 4400 {
+			t.Errorf("order %v seen %d times, expected about 4000", order, c)
+		}
+	}
+}
+
+func TestDeck_ReturnAndReset(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	deck := NewDeck(rng, []string{"a", "b", "c", "d", "e"})
+	deck.Draw()
+	x := deck.Draw()
+	if deck.Remaining() != 3 {
+		t.Fatalf("%d remaining, expected 3", deck.Remaining())
+	}
+	deck.Return()
+	if deck.Remaining() != 4 {
+		t.Fatalf("%d remaining after Return, expected 4", deck.Remaining())
+	}
+	if got := deck.DrawN(4); !slices.Contains(got, x) {
+		t.Fatalf("returned item %q not dealt again in %v", x, got)
+	}
+	deck.Reset()
+	if deck.Remaining() != 5 || deck.Len() != 5 {
+		t.Fatalf("Reset left %d of %d items", deck.Remaining(), deck.Len())
+	}
+	got := deck.DrawN(5)
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"a", "b", "c", "d", "e"}) {
+		t.Fatalf("deck after Reset dealt %v", got)
+	}
+}
+
+func TestDeck_Panics(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	for name, f := range map[string]func(){
+		"Draw":   func() { NewDeck[int](rng, nil).Draw() },
+		"DrawN":  func() { NewDeck(rng, []int{1}).DrawN(-1) },
+		"Return": func() { NewDeck(rng, []int{1}).Return() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
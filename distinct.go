@@ -0,0 +1,73 @@
+package batchedrand
+
+// MaxDistinct is the largest k accepted by DistinctK.
+const MaxDistinct = 6
+
+// DistinctK returns k distinct indices drawn uniformly from [0, n), in
+// uniformly random order, in the first k entries of the result. The
+// remaining entries are zero. For moderate n, all k indices come from a
+// single random word, as in Shuffle. DistinctK does not allocate.
+// It panics if k < 0, k > MaxDistinct or n < k.
+func (r *Rand) DistinctK(n, k int) [MaxDistinct]int {
+	if k < 0 || k > MaxDistinct || n < k {
+		panic("invalid argument to DistinctK")
+	}
+	var indexes [MaxDistinct]uint64
+	r.rangedIndices(uint64(n), indexes[:k])
+
+	// Partial Fisher-Yates over the virtual array 0, 1, ..., n-1: only the
+	// (at most k) displaced entries are recorded.
+	var keys, vals [MaxDistinct]int
+	m := 0
+	lookup := func(p int) int {
+		for j := 0; j < m; j++ {
+			if keys[j] == p {
+				return vals[j]
+			}
+		}
+		return p
+	}
+	var result [MaxDistinct]int
+	for j := 0; j < k; j++ {
+		pos := n - 1 - j
+		x := int(indexes[j])
+		result[j] = lookup(x)
+		if x == pos {
+			continue
+		}
+		v := lookup(pos)
+		found := false
+		for l := 0; l < m; l++ {
+			if keys[l] == x {
+				vals[l] = v
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys[m], vals[m] = x, v
+			m++
+		}
+	}
+	return result
+}
+
+// Distinct2 returns two distinct indices drawn uniformly from [0, n).
+// It panics if n < 2.
+func (r *Rand) Distinct2(n int) (int, int) {
+	if n < 2 {
+		panic("invalid argument to Distinct2")
+	}
+	d := r.DistinctK(n, 2)
+	return d[0], d[1]
+}
+
+// Distinct3 returns three distinct indices drawn uniformly from [0, n).
+// It panics if n < 3.
+func (r *Rand) Distinct3(n int) (int, int, int) {
+	if n < 3 {
+		panic("invalid argument to Distinct3")
+	}
+	d := r.DistinctK(n, 3)
+	return d[0], d[1], d[2]
+}
@@ -0,0 +1,94 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestDistinctK_Valid(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	// math.MaxInt>>23 is 2^40-1 with 64-bit ints, and the list still
+	// compiles with 32-bit ints (GOARCH=386).
+	for _, n := range []int{6, 7, 100, 1 << 20, math.MaxInt >> 23, math.MaxInt} {
+		for k := 0; k <= MaxDistinct; k++ {
+			for trial := 0; trial < 1000; trial++ {
+				d := rng.DistinctK(n, k)
+				seen := make(map[int]bool)
+				for j := 0; j < k; j++ {
+					if d[j] < 0 || d[j] >= n {
+						t.Fatalf("n=%d k=%d: index %d out of range", n, k, d[j])
+					}
+					if seen[d[j]] {
+						t.Fatalf("n=%d k=%d: duplicate index %d in %v", n, k, d[j], d)
+					}
+					seen[d[j]] = true
+				}
+				for j := k; j < MaxDistinct; j++ {
+					if d[j] != 0 {
+						t.Fatalf("n=%d k=%d: unused entry %d is %d", n, k, j, d[j])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDistinctK_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	// Every ordered triple of distinct values in [0, 6) should be equally likely.
+	const n, k = 6, 3
+	const tuples = n * (n - 1) * (n - 2)
+	const numDraws = tuples * 2000
+	counts := make(map[[3]int]int)
+	for i := 0; i < numDraws; i++ {
+		d := rng.DistinctK(n, k)
+		counts[[3]int{d[0], d[1], d[2]}]++
+	}
+	if len(counts) != tuples {
+		t.Fatalf("saw %d distinct tuples, expected %d", len(counts), tuples)
+	}
+	for tuple, c := range counts {
+		if c < 1700 || c > 2300 {
+			t.Errorf("tuple %v seen %d times, expected about 2000", tuple, c)
+		}
+	}
+}
+
+func TestDistinctK_Panics(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	for _, c := range [][2]int{{5, -1}, {5, 7}, {2, 3}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("DistinctK(%d, %d) did not panic", c[0], c[1])
+				}
+			}()
+			rng.DistinctK(c[0], c[1])
+		}()
+	}
+}
+
+func TestDistinctK_NoAlloc(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	allocs := testing.AllocsPerRun(100, func() {
+		rng.DistinctK(1000, 6)
+		rng.Distinct2(1000)
+		rng.Distinct3(1000)
+	})
+	if allocs != 0 {
+		t.Errorf("DistinctK allocates %v times per run", allocs)
+	}
+}
+
+func BenchmarkDistinctK(b *testing.B) {
+	for _, k := range []int{2, 3, 6} {
+		b.Run(fmt.Sprintf("Batched_k_%d", k), func(b *testing.B) {
+			rng := New(rand.NewPCG(1, 2))
+			for i := 0; i < b.N; i++ {
+				rng.DistinctK(1000, k)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// shuffleLevelsSingle is shuffleLevels with a single batch in flight.
+func shuffleLevelsSingle[S uint64Source](r S, n uint64, levels []batchLevel, swap func(i, j int)) {
+	for _, level := range levels {
+		if n > level.threshold {
+			n = shuffleLevel(r, n, level, swap)
+		}
+	}
+}
+
+func TestShuffleLevelDual_Uniform(t *testing.T) {
+	src := rand.NewPCG(1, 2)
+	// A single level down to 1, so that small sizes go through both the
+	// dual loop and the final batches of shuffleLevel.
+	level := batchLevel{k: 2, max: 1 << 30, threshold: 1, bound: 1 << 60}
+	for _, size := range []int{6, 7} {
+		checkShuffleUniform(t, fmt.Sprintf("size %d", size), size, int(factorials[size])*50, func(data []int) {
+			shuffleLevelDual(src, uint64(size), level, func(i, j int) {
+				data[i], data[j] = data[j], data[i]
+			})
+		})
+	}
+}
+
+func TestShuffleLevelDual_ConsumptionOrder(t *testing.T) {
+	// For this size, 2^64 mod n(n-1) is close to n(n-1), so that about one
+	// batch in 17 is rejected: the words must still be used in the
+	// documented order.
+	const size = 1042000000
+	level := batchLevel{k: 2, max: 1 << 30, threshold: size - 4000, bound: 1 << 60}
+	type pair struct{ i, j int }
+	var got []pair
+	shuffleLevelDual(rand.NewPCG(1, 2), size, level, func(i, j int) {
+		got = append(got, pair{i, j})
+	})
+
+	ref := rand.NewPCG(1, 2)
+	rejections := 0
+	// draw returns a batch of 2 for n from word, redrawing from ref while
+	// it is rejected.
+	draw := func(n, word uint64) (a0, a1 uint64) {
+		for {
+			a1, lo := bits.Mul64(n-1, word)
+			a0, lo := bits.Mul64(n, lo)
+			if !rejected(n, 2, lo) {
+				return a0, a1
+			}
+			rejections++
+			word = ref.Uint64()
+		}
+	}
+	var want []pair
+	i := uint64(size)
+	for ; i > level.threshold+2; i -= 4 {
+		wordA, wordB := ref.Uint64(), ref.Uint64()
+		a0, a1 := draw(i, wordA)
+		b0, b1 := draw(i-2, wordB)
+		want = append(want, pair{int(i - 2), int(a1)}, pair{int(i - 1), int(a0)})
+		want = append(want, pair{int(i - 4), int(b1)}, pair{int(i - 3), int(b0)})
+	}
+	if rejections == 0 {
+		t.Fatalf("no rejection to check")
+	}
+	for ; i > level.threshold; i -= 2 {
+		a0, a1 := draw(i, ref.Uint64())
+		want = append(want, pair{int(i - 2), int(a1)}, pair{int(i - 1), int(a0)})
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("dual-stream swaps differ from the documented order")
+	}
+}
+
+func BenchmarkDualStream(b *testing.B) {
+	src := rand.NewPCG(1, 2)
+	for _, size := range []int{30, 100, 500000, 1 << 22} {
+		data := getSlice(size)
+		swap := func(i, j int) { data[i], data[j] = data[j], data[i] }
+		b.Run(fmt.Sprintf("Single_size_%d", size), func(b *testing.B) {
+			for b.Loop() {
+				shuffleLevelsSingle(src, uint64(size), batchLevels64, swap)
+			}
+		})
+		b.Run(fmt.Sprintf("Dual_size_%d", size), func(b *testing.B) {
+			for b.Loop() {
+				shuffleLevels(src, uint64(size), batchLevels64, swap)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package batchedrand
+
+import (
+	"math"
+	"math/bits"
+	"math/rand/v2"
+)
+
+// maxFrugal is the largest bound accepted by Frugal.Uint64N. Before each
+// draw, the random state of a Frugal is grown to at least 2^61 (and below
+// 2^62), so that it always covers the bound.
+const maxFrugal = 1 << 61
+
+// Frugal draws ranged integers and shuffles while consuming as few random
+// bits as possible, for sources where each bit is expensive (crypto/rand,
+// hardware or metered sources). Rand discards the low-order remainder of
+// each batch, which is cheap with PCG but wasteful for such sources.
+// Instead, Frugal keeps a uniform random value c in [0, v) between draws:
+// a draw in [0, n) returns c mod n and keeps c / n, and when c falls in
+// the incomplete last block of size v mod n, that remainder is kept too.
+// Bits are taken from the source only to keep v large. A shuffle of n
+// elements thus consumes close to log2(n!) bits (see PermutationBits),
+// plus at most 62 bits held in reserve for later draws.
+//
+// A Frugal is slower than Rand, and not safe for concurrent use.
+type Frugal struct {
+	src rand.Source
+	// c is uniform in [0, v), independent of all output so far.
+	c, v uint64
+	// word holds nbits unused random bits, in its low-order bits.
+	word  uint64
+	nbits int
+	// consumed counts the bits taken from word.
+	consumed uint64
+}
+
+// NewFrugal returns a Frugal drawing bits from src. Any rand.Source will do,
+// including a Rand from NewSecure.
+func NewFrugal(src rand.Source) *Frugal {
+	return &Frugal{src: src, v: 1}
+}
+
+// BitsConsumed returns the number of random bits consumed so far. Bits
+// fetched from the source but not yet used are not counted.
+func (f *Frugal) BitsConsumed() uint64 {
+	return f.consumed
+}
+
+// takeBits returns k fresh random bits, 0 < k < 64.
+func (f *Frugal) takeBits(k int) uint64 {
+	f.consumed += uint64(k)
+	if f.nbits >= k {
+		x := f.word & (1<<k - 1)
+		f.word >>= k
+		f.nbits -= k
+		return x
+	}
+	// Use the nbits remaining bits, then the low bits of a new word.
+	x := f.word
+	k -= f.nbits
+	f.word = f.src.Uint64()
+	x = x<<k | f.word&(1<<k-1)
+	f.word >>= k
+	f.nbits = 64 - k
+	return x
+}
+
+// Uint64N returns a uniformly random value in [0, n).
+// It panics if n == 0 or n > 2^61.
+func (f *Frugal) Uint64N(n uint64) uint64 {
+	if n == 0 || n > maxFrugal {
+		panic("invalid argument to Uint64N")
+	}
+	for {
+		// Grow v to [2^61, 2^62) with fresh bits.
+		if k := bits.LeadingZeros64(f.v) - 2; k > 0 {
+			f.c = f.c<<k | f.takeBits(k)
+			f.v <<= k
+		}
+		q := f.v - f.v%n
+		if f.c < q {
+			// c is uniform over q = (q/n) * n values: its remainder is the
+			// result, and its quotient stays uniform in [0, q/n).
+			result := f.c % n
+			f.c /= n
+			f.v = q / n
+			return result
+		}
+		// c is uniform in [q, v): keep it as a value in [0, v-q).
+		f.c -= q
+		f.v -= q
+	}
+}
+
+// Shuffle pseudo-randomizes the order of elements, like Rand.Shuffle,
+// consuming close to log2(n!) random bits.
+// It panics if n < 0 or n > 2^61.
+func (f *Frugal) Shuffle(n int, swap func(i, j int)) {
+	if n < 0 || uint64(n) > maxFrugal {
+		panic("invalid argument to Shuffle")
+	}
+	for i := n - 1; i > 0; i-- {
+		j := f.Uint64N(uint64(i + 1))
+		swap(i, int(j))
+	}
+}
+
+// PermutationBits returns log2(n!), the minimum average number of random
+// bits needed to pick one of the n! permutations of n elements uniformly.
+func PermutationBits(n int) float64 {
+	lg, _ := math.Lgamma(float64(n) + 1)
+	return lg / math.Ln2
+}
@@ -0,0 +1,66 @@
+package batchedrand
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestFrugal_Uint64N(t *testing.T) {
+	f := NewFrugal(rand.NewPCG(1, 2))
+	for _, n := range []uint64{1, 2, 3, 7, 1000, 1 << 40, maxFrugal - 1, maxFrugal} {
+		for i := 0; i < 1000; i++ {
+			if x := f.Uint64N(n); x >= n {
+				t.Fatalf("Uint64N(%d) returned %d", n, x)
+			}
+		}
+	}
+	// Uniformity for a bound that does not divide a power of two.
+	counts := make([]int, 7)
+	const numDraws = 7 * 10000
+	for i := 0; i < numDraws; i++ {
+		counts[f.Uint64N(7)]++
+	}
+	for v, c := range counts {
+		if c < 9400 || c > 10600 {
+			t.Errorf("value %d drawn %d times, expected about 10000", v, c)
+		}
+	}
+}
+
+func TestFrugal_Shuffle(t *testing.T) {
+	f := NewFrugal(rand.NewChaCha8([32]byte{1, 2, 3}))
+	checkShuffleUniform(t, "Frugal.Shuffle", 4, 24*2000, func(data []int) {
+		f.Shuffle(len(data), func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+	})
+}
+
+func TestFrugal_BitsConsumed(t *testing.T) {
+	for _, size := range []int{10, 52, 1000, 100000} {
+		f := NewFrugal(rand.NewPCG(1, 2))
+		data := getSlice(size)
+		f.Shuffle(size, func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+		slices.Sort(data)
+		if !slices.Equal(data, getSlice(size)) {
+			t.Fatalf("size %d: result is not a permutation", size)
+		}
+		// All but at most 62 bits, held in reserve, should be needed.
+		lower := PermutationBits(size)
+		if got := float64(f.BitsConsumed()); got < lower || got > lower+64 {
+			t.Errorf("size %d: consumed %v bits, lower bound is %.1f", size, got, lower)
+		}
+	}
+}
+
+func TestPermutationBits(t *testing.T) {
+	for n, want := range map[int]float64{0: 0, 1: 0, 2: 1, 4: math.Log2(24), 20: math.Log2(2432902008176640000)} {
+		if got := PermutationBits(n); math.Abs(got-want) > 1e-9 {
+			t.Errorf("PermutationBits(%d) = %v, expected %v", n, got, want)
+		}
+	}
+}
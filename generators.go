@@ -0,0 +1,243 @@
+package batchedrand
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// The generators in this file are fast, non-cryptographic rand.Source
+// implementations, tuned for use with Rand. They are those used in the
+// benchmarks of the batched-random paper. Like *rand.PCG, they implement
+// encoding.BinaryAppender, encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler. None of them is safe for concurrent use.
+
+// A SplitMix64 is a SplitMix64 generator with 64 bits of state.
+// It is also used to seed the other generators of this package.
+type SplitMix64 struct {
+	state uint64
+}
+
+// NewSplitMix64 returns a new SplitMix64 generator seeded with seed.
+func NewSplitMix64(seed uint64) *SplitMix64 {
+	return &SplitMix64{seed}
+}
+
+// Seed resets the generator to behave the same way as NewSplitMix64(seed).
+func (s *SplitMix64) Seed(seed uint64) {
+	s.state = seed
+}
+
+// Uint64 returns a uniformly distributed random uint64 value.
+func (s *SplitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (s *SplitMix64) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, "splitmix64:"...)
+	return binary.BigEndian.AppendUint64(b, s.state), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (s *SplitMix64) MarshalBinary() ([]byte, error) {
+	return s.AppendBinary(make([]byte, 0, 19))
+}
+
+var errUnmarshalSplitMix64 = errors.New("invalid SplitMix64 encoding")
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (s *SplitMix64) UnmarshalBinary(data []byte) error {
+	words, ok := unmarshalWords(data, "splitmix64:", 1)
+	if !ok {
+		return errUnmarshalSplitMix64
+	}
+	s.state = words[0]
+	return nil
+}
+
+// A WyRand is a wyrand generator with 64 bits of state.
+type WyRand struct {
+	state uint64
+}
+
+// NewWyRand returns a new WyRand generator seeded with seed.
+func NewWyRand(seed uint64) *WyRand {
+	return &WyRand{seed}
+}
+
+// Seed resets the generator to behave the same way as NewWyRand(seed).
+func (w *WyRand) Seed(seed uint64) {
+	w.state = seed
+}
+
+// Uint64 returns a uniformly distributed random uint64 value.
+func (w *WyRand) Uint64() uint64 {
+	w.state += 0xa0761d6478bd642f
+	hi, lo := bits.Mul64(w.state, w.state^0xe7037ed1a0b428db)
+	return hi ^ lo
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (w *WyRand) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, "wyrand:"...)
+	return binary.BigEndian.AppendUint64(b, w.state), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (w *WyRand) MarshalBinary() ([]byte, error) {
+	return w.AppendBinary(make([]byte, 0, 15))
+}
+
+var errUnmarshalWyRand = errors.New("invalid WyRand encoding")
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (w *WyRand) UnmarshalBinary(data []byte) error {
+	words, ok := unmarshalWords(data, "wyrand:", 1)
+	if !ok {
+		return errUnmarshalWyRand
+	}
+	w.state = words[0]
+	return nil
+}
+
+// A Xoshiro256 is a xoshiro256** generator with 256 bits of state.
+type Xoshiro256 struct {
+	s [4]uint64
+}
+
+// NewXoshiro256 returns a new Xoshiro256 generator whose state is derived
+// from seed with SplitMix64, as recommended by its authors.
+func NewXoshiro256(seed uint64) *Xoshiro256 {
+	x := new(Xoshiro256)
+	x.Seed(seed)
+	return x
+}
+
+// Seed resets the generator to behave the same way as NewXoshiro256(seed).
+func (x *Xoshiro256) Seed(seed uint64) {
+	sm := SplitMix64{seed}
+	for i := range x.s {
+		x.s[i] = sm.Uint64()
+	}
+}
+
+// Uint64 returns a uniformly distributed random uint64 value.
+func (x *Xoshiro256) Uint64() uint64 {
+	s := &x.s
+	result := bits.RotateLeft64(s[1]*5, 7) * 9
+	t := s[1] << 17
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+	s[2] ^= t
+	s[3] = bits.RotateLeft64(s[3], 45)
+	return result
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (x *Xoshiro256) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, "xoshiro256:"...)
+	for _, w := range x.s {
+		b = binary.BigEndian.AppendUint64(b, w)
+	}
+	return b, nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (x *Xoshiro256) MarshalBinary() ([]byte, error) {
+	return x.AppendBinary(make([]byte, 0, 43))
+}
+
+var errUnmarshalXoshiro256 = errors.New("invalid Xoshiro256 encoding")
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+// The all-zero state, from which xoshiro256** only outputs zeros, is
+// rejected.
+func (x *Xoshiro256) UnmarshalBinary(data []byte) error {
+	words, ok := unmarshalWords(data, "xoshiro256:", 4)
+	if !ok || words[0]|words[1]|words[2]|words[3] == 0 {
+		return errUnmarshalXoshiro256
+	}
+	copy(x.s[:], words)
+	return nil
+}
+
+// lehmerMultiplier is the 64-bit multiplier of Lehmer.
+const lehmerMultiplier = 0xda942042e4dd58b5
+
+// A Lehmer is the lehmer64 generator of the benchmarks of the paper: a
+// multiplicative congruential (Lehmer) generator with 128 bits of state and
+// a 64-bit multiplier, returning the high 64 bits of the state after each
+// multiplication.
+type Lehmer struct {
+	hi, lo uint64
+}
+
+// NewLehmer returns a new Lehmer generator whose state is derived from
+// seed with SplitMix64.
+func NewLehmer(seed uint64) *Lehmer {
+	l := new(Lehmer)
+	l.Seed(seed)
+	return l
+}
+
+// Seed resets the generator to behave the same way as NewLehmer(seed).
+func (l *Lehmer) Seed(seed uint64) {
+	sm := SplitMix64{seed}
+	l.hi = sm.Uint64()
+	// An odd state gives the generator its full period.
+	l.lo = sm.Uint64() | 1
+}
+
+// Uint64 returns a uniformly distributed random uint64 value.
+func (l *Lehmer) Uint64() uint64 {
+	hi, lo := bits.Mul64(l.lo, lehmerMultiplier)
+	l.hi = hi + l.hi*lehmerMultiplier
+	l.lo = lo
+	return l.hi
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (l *Lehmer) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, "lehmer:"...)
+	b = binary.BigEndian.AppendUint64(b, l.hi)
+	return binary.BigEndian.AppendUint64(b, l.lo), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (l *Lehmer) MarshalBinary() ([]byte, error) {
+	return l.AppendBinary(make([]byte, 0, 23))
+}
+
+var errUnmarshalLehmer = errors.New("invalid Lehmer encoding")
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+// Even states, which shorten the period, are rejected.
+func (l *Lehmer) UnmarshalBinary(data []byte) error {
+	words, ok := unmarshalWords(data, "lehmer:", 2)
+	if !ok || words[1]&1 == 0 {
+		return errUnmarshalLehmer
+	}
+	l.hi, l.lo = words[0], words[1]
+	return nil
+}
+
+// unmarshalWords decodes the encoding produced by the AppendBinary methods
+// of this package: prefix followed by n big-endian words.
+func unmarshalWords(data []byte, prefix string, n int) ([]uint64, bool) {
+	if len(data) != len(prefix)+8*n || string(data[:len(prefix)]) != prefix {
+		return nil, false
+	}
+	data = data[len(prefix):]
+	words := make([]uint64, n)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint64(data[8*i:])
+	}
+	return words, true
+}
@@ -0,0 +1,155 @@
+package batchedrand
+
+import (
+	"encoding"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// generator is the interface shared by the generators of this package.
+type generator interface {
+	rand.Source
+	Seed(seed uint64)
+	encoding.BinaryAppender
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+var generators = map[string]func(seed uint64) generator{
+	"SplitMix64": func(seed uint64) generator { return NewSplitMix64(seed) },
+	"WyRand":     func(seed uint64) generator { return NewWyRand(seed) },
+	"Xoshiro256": func(seed uint64) generator { return NewXoshiro256(seed) },
+	"Lehmer":     func(seed uint64) generator { return NewLehmer(seed) },
+}
+
+func TestGenerators_KnownAnswers(t *testing.T) {
+	// Computed with the reference C implementations (those of the next
+	// test), seeded as the generators of this package: the Xoshiro256 and
+	// Lehmer states are the first words of SplitMix64, the low word of the
+	// Lehmer state forced odd.
+	want := map[string][]uint64{
+		"SplitMix64": {6457827717110365317, 3203168211198807973, 9817491932198370423, 4593380528125082431, 16408922859458223821},
+		"WyRand":     {1039220411907061708, 7824934774743837796, 15045726798686391609, 11897712078968232033, 16181740736517372213},
+		"Xoshiro256": {3504822795582309479, 1819558768956484042, 1250851346055027673, 16940231675099994102, 11585879347611423030},
+		"Lehmer":     {3590288798613120721, 2774553695440097293, 4834922491677889201, 12726398165822225075, 3344884503331303072},
+	}
+	for name, newGenerator := range generators {
+		g := newGenerator(1234567)
+		for i, w := range want[name] {
+			if got := g.Uint64(); got != w {
+				t.Errorf("%s: word %d is %d, expected %d", name, i, got, w)
+			}
+		}
+	}
+}
+
+func TestGenerators_ReferenceVectors(t *testing.T) {
+	// From the reference implementations: splitmix64.c and
+	// xoshiro256starstar.c by Vigna, wyrand from wyhash (final3) by Wang
+	// Yi, and lehmer64 by Lemire.
+	sm := NewSplitMix64(0)
+	for i, w := range []uint64{0xe220a8397b1dcdaf, 0x6e789e6aa1b965f4, 0x06c45d188009454f} {
+		if got := sm.Uint64(); got != w {
+			t.Errorf("SplitMix64: word %d is %#x, expected %#x", i, got, w)
+		}
+	}
+	x := &Xoshiro256{[4]uint64{1, 2, 3, 4}}
+	for i, w := range []uint64{11520, 0, 1509978240, 1215971899390074240} {
+		if got := x.Uint64(); got != w {
+			t.Errorf("Xoshiro256: word %d is %d, expected %d", i, got, w)
+		}
+	}
+	wy := NewWyRand(0)
+	for i, w := range []uint64{0x111cb3a78f59a58e, 0xceabd938ff4e856d, 0x61fb51318f47d2a4} {
+		if got := wy.Uint64(); got != w {
+			t.Errorf("WyRand: word %d is %#x, expected %#x", i, got, w)
+		}
+	}
+	l := &Lehmer{hi: 0, lo: 1}
+	for i, w := range []uint64{0, 0xbaa09ca73f3265b4, 0xdb76c43996e558d0} {
+		if got := l.Uint64(); got != w {
+			t.Errorf("Lehmer: word %d is %#x, expected %#x", i, got, w)
+		}
+	}
+}
+
+func TestGenerators_Seed(t *testing.T) {
+	for name, newGenerator := range generators {
+		g := newGenerator(42)
+		first := g.Uint64()
+		g.Uint64()
+		g.Seed(42)
+		if got := g.Uint64(); got != first {
+			t.Errorf("%s: reseeding gave %d, expected %d", name, got, first)
+		}
+	}
+}
+
+func TestGenerators_Marshal(t *testing.T) {
+	for name, newGenerator := range generators {
+		g := newGenerator(42)
+		g.Uint64()
+		data, err := g.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: MarshalBinary: %v", name, err)
+		}
+		appended, _ := g.AppendBinary([]byte("x"))
+		if !slices.Equal(appended[1:], data) {
+			t.Errorf("%s: AppendBinary and MarshalBinary disagree", name)
+		}
+		restored := newGenerator(0)
+		if err := restored.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: UnmarshalBinary: %v", name, err)
+		}
+		for i := 0; i < 10; i++ {
+			if x, y := g.Uint64(), restored.Uint64(); x != y {
+				t.Fatalf("%s: restored generator gave %d, expected %d", name, y, x)
+			}
+		}
+		for _, bad := range [][]byte{nil, data[:len(data)-1], append([]byte("z"), data[1:]...)} {
+			if err := restored.UnmarshalBinary(bad); err == nil {
+				t.Errorf("%s: UnmarshalBinary(%q) did not fail", name, bad)
+			}
+		}
+	}
+	zero, _ := (&Xoshiro256{}).MarshalBinary()
+	if err := new(Xoshiro256).UnmarshalBinary(zero); err == nil {
+		t.Errorf("Xoshiro256: UnmarshalBinary accepted the all-zero state")
+	}
+	even, _ := (&Lehmer{hi: 1, lo: 2}).MarshalBinary()
+	if err := new(Lehmer).UnmarshalBinary(even); err == nil {
+		t.Errorf("Lehmer: UnmarshalBinary accepted an even state")
+	}
+}
+
+func TestGenerators_Shuffle(t *testing.T) {
+	for name, newGenerator := range generators {
+		rng := New(newGenerator(42))
+		data := getSlice(1000)
+		rng.Shuffle(len(data), func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+		slices.Sort(data)
+		if !slices.Equal(data, getSlice(1000)) {
+			t.Fatalf("%s: result is not a permutation", name)
+		}
+	}
+}
+
+func BenchmarkGenerators(b *testing.B) {
+	for _, name := range []string{"SplitMix64", "WyRand", "Xoshiro256", "Lehmer"} {
+		for _, size := range []int{30, 100, 500000} {
+			b.Run(fmt.Sprintf("%s/Batched_size_%d", name, size), func(b *testing.B) {
+				rng := New(generators[name](42))
+				data := getSlice(size)
+				for i := 0; i < b.N; i++ {
+					rng.Shuffle(len(data), func(i, j int) {
+						data[i], data[j] = data[j], data[i]
+					})
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package batchedrand
+
+import "iter"
+
+// Interleave returns a sequence of source ids, in which id s appears
+// lengths[s] times, such that every interleaving of the sources is equally
+// likely. Reading each source in order as its id comes up merges the
+// sources while keeping each one's internal order; merging independently
+// shuffled shards this way yields a uniform shuffle of their union.
+// Each iteration of the sequence draws a new interleaving. Choosing a
+// source takes time proportional to the number of sources.
+// Interleave panics if any length is negative.
+func (r *Rand) Interleave(lengths []int) iter.Seq[int] {
+	total := 0
+	for _, l := range lengths {
+		if l < 0 {
+			panic("invalid argument to Interleave")
+		}
+		total += l
+	}
+	return func(yield func(int) bool) {
+		remaining := append([]int(nil), lengths...)
+		var indexes [MaxDistinct]uint64
+		for n := total; n > 0; {
+			k := min(batchSize(uint64(n)), n)
+			r.batchedIndices(uint64(n), indexes[:k])
+			for _, u := range indexes[:k] {
+				// The next item is drawn uniformly among the n remaining
+				// ones, so source s comes up with probability remaining[s]/n.
+				s := 0
+				for v := int(u); v >= remaining[s]; s++ {
+					v -= remaining[s]
+				}
+				remaining[s]--
+				n--
+				if !yield(s) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// InterleaveSlices returns a new slice merging the given slices in a
+// uniformly random interleaving that keeps each slice's internal order.
+func InterleaveSlices[T any](r *Rand, slices ...[]T) []T {
+	lengths := make([]int, len(slices))
+	total := 0
+	for i, s := range slices {
+		lengths[i] = len(s)
+		total += len(s)
+	}
+	out := make([]T, 0, total)
+	next := make([]int, len(slices))
+	for s := range r.Interleave(lengths) {
+		out = append(out, slices[s][next[s]])
+		next[s]++
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package batchedrand
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestInterleave_Counts(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	lengths := []int{0, 5, 1000, 1, 0, 77}
+	counts := make([]int, len(lengths))
+	for s := range rng.Interleave(lengths) {
+		counts[s]++
+	}
+	if !slices.Equal(counts, lengths) {
+		t.Fatalf("got counts %v, expected %v", counts, lengths)
+	}
+	for range rng.Interleave(nil) {
+		t.Fatalf("empty interleaving yielded an id")
+	}
+}
+
+func TestInterleave_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	// There are 4!/(2!1!1!) = 12 interleavings of sources of lengths 2, 1, 1.
+	counts := make(map[[4]int]int)
+	const numTrials = 12 * 5000
+	for trial := 0; trial < numTrials; trial++ {
+		var key [4]int
+		i := 0
+		for s := range rng.Interleave([]int{2, 1, 1}) {
+			key[i] = s
+			i++
+		}
+		counts[key]++
+	}
+	if len(counts) != 12 {
+		t.Fatalf("saw %d interleavings, expected 12", len(counts))
+	}
+	for key, c := range counts {
+		if c < 4500 || c > 5500 {
+			t.Errorf("interleaving %v seen %d times, expected about 5000", key, c)
+		}
+	}
+}
+
+func TestInterleaveSlices(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	a := []int{0, 1, 2, 3, 4}
+	b := []int{100, 101, 102}
+	c := []int{200}
+	got := InterleaveSlices(rng, a, b, nil, c)
+	if len(got) != len(a)+len(b)+len(c) {
+		t.Fatalf("got %d items, expected %d", len(got), len(a)+len(b)+len(c))
+	}
+	var gotA, gotB, gotC []int
+	for _, x := range got {
+		switch {
+		case x < 100:
+			gotA = append(gotA, x)
+		case x < 200:
+			gotB = append(gotB, x)
+		default:
+			gotC = append(gotC, x)
+		}
+	}
+	if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) || !slices.Equal(gotC, c) {
+		t.Fatalf("interleaving %v does not keep each slice's order", got)
+	}
+}
+
+func TestInterleave_Panics(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Interleave with a negative length did not panic")
+		}
+	}()
+	rng.Interleave([]int{1, -1})
+}
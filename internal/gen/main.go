@@ -0,0 +1,441 @@
+// Gen writes the unrolled shuffle kernels of batchedrand.
+//
+// Each target is a variant of shuffleLevel, the loop of the batched
+// algorithm within one batch level, whose batches of 2 to maxUnrolled
+// indices are unrolled from a single template. The targets differ in
+// where they draw their words from (any source, a *rand.PCG or a
+// *rand.ChaCha8 with direct calls to Uint64, the buffer of a Buffered
+// source, or the 32-bit halves of the words of Shuffle32), and in how they
+// swap (through the swap callback of Shuffle or the 64-bit one of
+// Shuffle64, or directly in a slice of any element type, []uint32
+// included). A target can also get a variant with
+// two batches in flight, for large shuffles (see dualStreamThreshold).
+//
+// The partial shuffles of the package take no kernel: a Deck draws one
+// batch of positions at a time and deals them one by one, and DistinctK
+// draws a single batch.
+//
+// Run it with go generate in the root directory of the module.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// maxUnrolled is the largest unrolled batch size. It matches
+// defaultMaxBatch: larger batches, only used with expensive sources, take
+// the generic loop.
+const maxUnrolled = 6
+
+// maxDualUnrolled is the largest batch size with two batches in flight:
+// only batches of 2 are used above dualStreamThreshold.
+const maxDualUnrolled = 2
+
+// A target is a variant of shuffleLevel.
+type target struct {
+	// Name is the name of the function. Its dual variant, if any, is
+	// named Name + "Dual".
+	Name string
+	// Doc is its doc comment, without the comment markers.
+	Doc string
+	// DualDoc is the doc comment of the dual variant, which is only
+	// generated if DualDoc is set.
+	DualDoc string
+	// TypeParams are the type parameters of the function, if any.
+	TypeParams string
+	// Source is the type of r, the source of the words.
+	Source string
+	// Imports are the packages that Source needs, if any.
+	Imports []string
+	// WordBits is the size of the words of r, 64 or 32.
+	WordBits int
+	// Word returns the statement that sets the variable v to the next
+	// word of r.
+	Word func(v string) string
+	// Params are the parameters that follow r, i and level.
+	Params string
+	// Swap returns the statement that swaps the elements at the
+	// positions a and b.
+	Swap func(a, b string) string
+}
+
+// Uint returns the unsigned type of the words and positions of t.
+func (t target) Uint() string {
+	return fmt.Sprintf("uint%d", t.WordBits)
+}
+
+// Mul returns the full-width multiplication of the words of t.
+func (t target) Mul() string {
+	return fmt.Sprintf("bits.Mul%d", t.WordBits)
+}
+
+// Func returns the name of the helper of table.go (or its 32-bit
+// counterpart) for the words of t.
+func (t target) Func(name string) string {
+	if t.WordBits == 64 {
+		return name
+	}
+	return fmt.Sprintf("%s%d", name, t.WordBits)
+}
+
+// Level returns the expression of the field of level, converted to Uint.
+func (t target) Level(field string) string {
+	if t.WordBits == 64 {
+		return "level." + field
+	}
+	return fmt.Sprintf("%s(level.%s)", t.Uint(), field)
+}
+
+// sourceWord draws a word through the Uint64 method of r.
+func sourceWord(v string) string {
+	return v + " := r.Uint64()"
+}
+
+// swapCallback swaps through the swap callback of Shuffle.
+func swapCallback(a, b string) string {
+	return fmt.Sprintf("swap(int(%s), int(%s))", a, b)
+}
+
+// swapCallback64 swaps through the swap callback of Shuffle64, which takes
+// 64-bit indexes.
+func swapCallback64(a, b string) string {
+	return fmt.Sprintf("swap(%s, %s)", a, b)
+}
+
+// swapSlice swaps the elements of s.
+func swapSlice(a, b string) string {
+	return fmt.Sprintf("s[%[1]s], s[%[2]s] = s[%[2]s], s[%[1]s]", a, b)
+}
+
+const levelDoc = `performs the swaps of the batched algorithm from i
+remaining elements down to the threshold of level, and returns the new
+number of remaining elements. At the last level, the i-1 remaining
+indices are drawn in a single batch. Batches of 2 to 6, those of all
+but small shuffles, are unrolled; only their rare slow path goes through
+drawBatch.`
+
+const dualDoc = `is %s with two batches in flight: the chain of
+multiplications of a batch is sequential, but those of two consecutive
+batches are independent, so the processor can interleave their
+multiplications and memory accesses. Only batches of 2, used above 2^19
+elements, have two streams; other batch sizes, and the last batches, are
+left to %s.
+
+The two batches are drawn from consecutive words of the source, the
+first for the upper batch; rejections are then resolved for the upper
+batch, and then for the lower one. Barring rejections, the words are
+thus used exactly as by %s, and so are the swaps. Each batch
+depends only on its own words, so both remain exactly uniform.`
+
+var targets = []target{
+	{
+		Name:       "shuffleLevel",
+		Doc:        "shuffleLevel " + levelDoc,
+		DualDoc:    fmt.Sprintf("shuffleLevelDual "+dualDoc, "shuffleLevel", "shuffleLevel", "shuffleLevel"),
+		TypeParams: "[S uint64Source]",
+		Source:     "S",
+		WordBits:   64,
+		Word:       sourceWord,
+		Params:     "swap func(i, j int)",
+		Swap:       swapCallback,
+	},
+	{
+		Name: "shuffleLevelPCG",
+		Doc: `shuffleLevelPCG is shuffleLevel for a *rand.PCG source, whose Uint64
+method it calls directly rather than through an interface.`,
+		DualDoc:  "shuffleLevelPCGDual is shuffleLevelDual for a *rand.PCG source.",
+		Source:   "*rand.PCG",
+		Imports:  []string{"math/rand/v2"},
+		WordBits: 64,
+		Word:     sourceWord,
+		Params:   "swap func(i, j int)",
+		Swap:     swapCallback,
+	},
+	{
+		Name: "shuffleLevelChaCha8",
+		Doc: `shuffleLevelChaCha8 is shuffleLevel for a *rand.ChaCha8 source, whose
+Uint64 method it calls directly rather than through an interface.`,
+		DualDoc:  "shuffleLevelChaCha8Dual is shuffleLevelDual for a *rand.ChaCha8 source.",
+		Source:   "*rand.ChaCha8",
+		Imports:  []string{"math/rand/v2"},
+		WordBits: 64,
+		Word:     sourceWord,
+		Params:   "swap func(i, j int)",
+		Swap:     swapCallback,
+	},
+	{
+		Name: "shuffleLevelBuffered",
+		Doc: `shuffleLevelBuffered is shuffleLevel for a Buffered source: it reads
+the words straight from the buffer, refilling it when it is empty,
+rather than calling Uint64 for each word.`,
+		DualDoc:  "shuffleLevelBufferedDual is shuffleLevelDual for a Buffered source.",
+		Source:   "*Buffered",
+		WordBits: 64,
+		Word: func(v string) string {
+			return fmt.Sprintf(`if r.pos == bufferedWords {
+	r.refill()
+}
+%s := r.buf[r.pos]
+r.pos++`, v)
+		},
+		Params: "swap func(i, j int)",
+		Swap:   swapCallback,
+	},
+	{
+		Name: "shuffleLevelSlice",
+		Doc: `shuffleLevelSlice is shuffleLevel for the elements of s, which it
+swaps directly rather than through a callback.`,
+		DualDoc:    "shuffleLevelSliceDual is shuffleLevelDual for the elements of s.",
+		TypeParams: "[S uint64Source, T any]",
+		Source:     "S",
+		WordBits:   64,
+		Word:       sourceWord,
+		Params:     "s []T",
+		Swap:       swapSlice,
+	},
+	{
+		Name: "shuffleLevel64",
+		Doc: `shuffleLevel64 is shuffleLevel for Shuffle64, whose swap callback
+takes 64-bit indexes.`,
+		DualDoc:    "shuffleLevel64Dual is shuffleLevelDual for Shuffle64.",
+		TypeParams: "[S uint64Source]",
+		Source:     "S",
+		WordBits:   64,
+		Word:       sourceWord,
+		Params:     "swap func(i, j uint64)",
+		Swap:       swapCallback64,
+	},
+	{
+		Name: "shuffleLevel32",
+		Doc: `shuffleLevel32 is shuffleLevel for Shuffle32, with 32-bit words and
+arithmetic.`,
+		Source:   "*wordHalves",
+		WordBits: 32,
+		Word: func(v string) string {
+			return v + " := r.Uint32()"
+		},
+		Params: "swap func(i, j int)",
+		Swap:   swapCallback,
+	},
+}
+
+// A batch describes an unrolled batch of K indices.
+type batch struct {
+	K int
+	// Indexes are the names of the K indices, index0 to index(K-1).
+	Indexes []string
+}
+
+// names returns the names prefix0 to prefix(k-1).
+func names(prefix string, k int) []string {
+	var names []string
+	for j := 0; j < k; j++ {
+		names = append(names, fmt.Sprintf("%s%d", prefix, j))
+	}
+	return names
+}
+
+// position returns the expression of i-j.
+func position(j int) string {
+	if j == 0 {
+		return "i"
+	}
+	return fmt.Sprintf("i-%d", j)
+}
+
+var funcs = template.FuncMap{
+	"position":   position,
+	"names":      names,
+	"paramNames": paramNames,
+	"join":       strings.Join,
+	"comment": func(doc string) string {
+		doc = "// " + strings.ReplaceAll(doc, "\n", "\n// ")
+		return strings.ReplaceAll(doc, "// \n", "//\n")
+	},
+	// rev returns indexes in reverse order: the multiplications and swaps
+	// of a batch go from the last index to the first.
+	"rev": func(indexes []string) []string {
+		rev := make([]string, len(indexes))
+		for j, index := range indexes {
+			rev[len(indexes)-1-j] = index
+		}
+		return rev
+	},
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+}
+
+var kernels = template.Must(template.New("kernels").Funcs(funcs).Parse(`// Code generated by internal/gen; DO NOT EDIT.
+
+package batchedrand
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+{{range $t := .Targets}}
+{{comment $t.Doc}}
+func {{$t.Name}}{{$t.TypeParams}}(r {{$t.Source}}, i {{$t.Uint}}, level batchLevel, {{$t.Params}}) {{$t.Uint}} {
+	bound := {{$t.Level "bound"}}
+	// The unrolled loops stop before a batch could exceed i-1 indices.
+	stop := max({{$t.Level "threshold"}}, {{$t.Uint}}(level.k))
+	switch level.k {
+{{- range $b := $.Batches}}
+	case {{$b.K}}:
+		for ; i > stop; i -= {{$b.K}} {
+			{{call $t.Word "word"}}
+{{- range $j, $index := rev $b.Indexes}}
+	{{- $pos := sub (sub $b.K 1) $j}}
+			{{$index}}, lo := {{$t.Mul}}({{position $pos}}, {{if eq $j 0}}word{{else}}lo{{end}})
+{{- end}}
+			if lo < bound && {{$t.Func "rejected"}}(i, {{$b.K}}, lo) {
+				var indexes [maxBatch]{{$t.Uint}}
+				{{$t.Func "drawBatch"}}(r, i, {{$b.K}}, bound, &indexes)
+				{{join $b.Indexes ", "}} = {{range $j, $index := $b.Indexes}}{{if $j}}, {{end}}indexes[{{$j}}]{{end}}
+			}
+{{- range $j, $index := rev $b.Indexes}}
+			{{call $t.Swap (position (sub $b.K $j)) $index}}
+{{- end}}
+		}
+{{- end}}
+	}
+	// Any batch size, and the final batch.
+	var indexes [maxBatch]{{$t.Uint}}
+	for i > {{$t.Level "threshold"}} {
+		k := min(level.k, int(i-1))
+		batch := indexes[:k]
+		{{call $t.Word "word"}}
+		randVal := word
+		for j := len(batch) - 1; j >= 0; j-- {
+			batch[j], randVal = {{$t.Mul}}(i-{{$t.Uint}}(j), randVal)
+		}
+		if randVal < bound && {{$t.Func "rejected"}}(i, k, randVal) {
+			{{$t.Func "drawBatch"}}(r, i, k, bound, &indexes)
+		}
+		for j := len(batch) - 1; j >= 0; j-- {
+			{{call $t.Swap (printf "i-1-%s(j)" $t.Uint) "batch[j]"}}
+		}
+		i -= {{$t.Uint}}(k)
+	}
+	return i
+}
+{{- if $t.DualDoc}}
+
+{{comment $t.DualDoc}}
+func {{$t.Name}}Dual{{$t.TypeParams}}(r {{$t.Source}}, i {{$t.Uint}}, level batchLevel, {{$t.Params}}) {{$t.Uint}} {
+	bound := {{$t.Level "bound"}}
+	// Both batches must fit above the stop of {{$t.Name}}.
+	stop := max({{$t.Level "threshold"}}, {{$t.Uint}}(level.k)) + {{$t.Uint}}(level.k)
+	switch level.k {
+{{- range $b := $.DualBatches}}
+	{{- $upper := names "a" $b.K}}
+	{{- $lower := names "b" $b.K}}
+	case {{$b.K}}:
+		for ; i > stop; i -= {{add $b.K $b.K}} {
+			{{call $t.Word "wordA"}}
+			{{call $t.Word "wordB"}}
+{{- range $j, $index := rev $upper}}
+	{{- $pos := sub (sub $b.K 1) $j}}
+			{{$index}}, loA := {{$t.Mul}}({{position $pos}}, {{if eq $j 0}}wordA{{else}}loA{{end}})
+			{{index (rev $lower) $j}}, loB := {{$t.Mul}}({{position (add $b.K $pos)}}, {{if eq $j 0}}wordB{{else}}loB{{end}})
+{{- end}}
+			if loA < bound && {{$t.Func "rejected"}}(i, {{$b.K}}, loA) {
+				var indexes [maxBatch]{{$t.Uint}}
+				{{$t.Func "drawBatch"}}(r, i, {{$b.K}}, bound, &indexes)
+				{{join $upper ", "}} = {{range $j, $index := $upper}}{{if $j}}, {{end}}indexes[{{$j}}]{{end}}
+			}
+			if loB < bound && {{$t.Func "rejected"}}({{position $b.K}}, {{$b.K}}, loB) {
+				var indexes [maxBatch]{{$t.Uint}}
+				{{$t.Func "drawBatch"}}(r, {{position $b.K}}, {{$b.K}}, bound, &indexes)
+				{{join $lower ", "}} = {{range $j, $index := $lower}}{{if $j}}, {{end}}indexes[{{$j}}]{{end}}
+			}
+{{- range $j, $index := rev $upper}}
+			{{call $t.Swap (position (sub $b.K $j)) $index}}
+{{- end}}
+{{- range $j, $index := rev $lower}}
+			{{call $t.Swap (position (sub (add $b.K $b.K) $j)) $index}}
+{{- end}}
+		}
+{{- end}}
+	}
+	return {{$t.Name}}(r, i, level, {{range $j, $p := paramNames $t}}{{if $j}}, {{end}}{{$p}}{{end}})
+}
+{{- end}}
+{{end -}}
+`))
+
+// paramNames returns the names of the parameters of t that follow level,
+// one per parameter: the commas within a parameter type are skipped.
+func paramNames(t target) []string {
+	var names []string
+	depth, start := 0, 0
+	for i, c := range t.Params + "," {
+		switch c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				names = append(names, strings.Fields(t.Params[start:i])[0])
+				start = i + 1
+			}
+		}
+	}
+	return names
+}
+
+// batches returns the unrolled batches of 2 to maxK indices.
+func batches(maxK int) []batch {
+	var batches []batch
+	for k := 2; k <= maxK; k++ {
+		batches = append(batches, batch{K: k, Indexes: names("index", k)})
+	}
+	return batches
+}
+
+// imports returns the packages that the kernels import, in order.
+func imports() []string {
+	imports := []string{"math/bits"}
+	for _, t := range targets {
+		imports = append(imports, t.Imports...)
+	}
+	slices.Sort(imports)
+	return slices.Compact(imports)
+}
+
+// generate returns the formatted source of the kernels.
+func generate() ([]byte, error) {
+	var buf bytes.Buffer
+	err := kernels.Execute(&buf, struct {
+		Imports     []string
+		Targets     []target
+		Batches     []batch
+		DualBatches []batch
+	}{imports(), targets, batches(maxUnrolled), batches(maxDualUnrolled)})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func main() {
+	output := flag.String("o", "shufflelevel_gen.go", "output file")
+	flag.Parse()
+	src, err := generate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
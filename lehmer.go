@@ -0,0 +1,261 @@
+package batchedrand
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// The Lehmer code of a permutation p of n elements lists, for each index
+// k, the number of indices j > k with p[j] < p[k]: a digit in [0, n-k).
+// These are the digits of p in the factorial number system, which maps the
+// n! permutations one-to-one to the mixed-radix numbers of radices n,
+// n-1, ..., 1: the same ranges as the indices that Shuffle draws.
+//
+// The binary encoding of a permutation packs its Lehmer code in about
+// log2(n!) bits. The digits are grouped as the indices of Shuffle are
+// batched, as many per group as the product of their radices fits in 64
+// bits (and at most maxBatch), and each group, a mixed-radix number below
+// that product P, takes bits.Len64(P-1) bits: less than one bit per group
+// is lost, such as 3 bits for the 226 bits of a deck of 52 cards. Decoding
+// a group divides the number by P once and then runs the multiplication
+// chain of Shuffle (batchIndices), which yields the digits exactly.
+
+// Errors returned by the decoding functions.
+var (
+	errPermutationEncoding = errors.New("invalid permutation encoding")
+	errLehmerDigit         = errors.New("invalid Lehmer code: digit out of range")
+)
+
+// fenwick is a Fenwick tree of counts, for prefix sums in O(log n).
+type fenwick []int
+
+// add adds delta to the count of i.
+func (f fenwick) add(i, delta int) {
+	for i++; i <= len(f); i += i & -i {
+		f[i-1] += delta
+	}
+}
+
+// prefix returns the sum of the counts of 0 to i-1.
+func (f fenwick) prefix(i int) int {
+	sum := 0
+	for ; i > 0; i -= i & -i {
+		sum += f[i-1]
+	}
+	return sum
+}
+
+// find returns the smallest i such that the counts of 0 to i sum to more
+// than rank, all counts being 0 or 1.
+func (f fenwick) find(rank int) int {
+	i := 0
+	for step := 1 << (bits.Len(uint(len(f))) - 1); step > 0; step >>= 1 {
+		if i+step <= len(f) && f[i+step-1] <= rank {
+			i += step
+			rank -= f[i-1]
+		}
+	}
+	return i
+}
+
+// LehmerCode returns the Lehmer code of p, which must be valid.
+func (p Permutation) LehmerCode() []int {
+	code := make([]int, len(p))
+	seen := make(fenwick, len(p))
+	for k := len(p) - 1; k >= 0; k-- {
+		code[k] = seen.prefix(p[k])
+		seen.add(p[k], 1)
+	}
+	return code
+}
+
+// PermutationFromLehmerCode returns the permutation whose Lehmer code is
+// code, or an error if a digit code[k] is not in [0, len(code)-k).
+func PermutationFromLehmerCode(code []int) (Permutation, error) {
+	n := len(code)
+	for k, digit := range code {
+		if digit < 0 || digit >= n-k {
+			return nil, errLehmerDigit
+		}
+	}
+	// p[k] is the code[k]-th smallest of the values left.
+	left := make(fenwick, n)
+	for i := range left {
+		left.add(i, 1)
+	}
+	p := make(Permutation, n)
+	for k, digit := range code {
+		p[k] = left.find(digit)
+		left.add(p[k], -1)
+	}
+	return p, nil
+}
+
+// lehmerGroup returns the number k of digits in the group of the Lehmer
+// code that starts with the radix n, and the product of their radices.
+func lehmerGroup(n uint64) (k int, product uint64) {
+	k = batchLength(n, int(min(n, maxBatch)))
+	product = 1
+	for j := 0; j < k; j++ {
+		product *= n - uint64(j)
+	}
+	return k, product
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface. The
+// encoding is the number of elements as a uvarint, followed by the packed
+// Lehmer code, with no type prefix so as to remain compact. It returns an
+// error if p is not valid.
+func (p Permutation) AppendBinary(b []byte) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	code := p.LehmerCode()
+	w := bitWriter{buf: binary.AppendUvarint(b, uint64(len(p)))}
+	for len(code) > 0 {
+		k, product := lehmerGroup(uint64(len(code)))
+		// The first digit of the multiplication chain, that of radix
+		// n-k+1, is the most significant.
+		x := uint64(0)
+		for j := k - 1; j >= 0; j-- {
+			x = x*uint64(len(code)-j) + uint64(code[j])
+		}
+		w.write(x, bits.Len64(product-1))
+		code = code[k:]
+	}
+	return w.flush(), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (p Permutation) MarshalBinary() ([]byte, error) {
+	return p.AppendBinary(nil)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (p *Permutation) UnmarshalBinary(data []byte) error {
+	size, used := binary.Uvarint(data)
+	if used <= 0 {
+		return errPermutationEncoding
+	}
+	data = data[used:]
+	// A valid encoding has at least log2(n!) >= n-8 bits, so that a forged
+	// size cannot make us allocate much more than the encoding.
+	if size > 8*uint64(len(data))+8 {
+		return errPermutationEncoding
+	}
+	code := make([]int, size)
+	r := bitReader{buf: data}
+	var digits [maxBatch]uint64
+	for pos := 0; pos < len(code); {
+		n := uint64(len(code) - pos)
+		k, product := lehmerGroup(n)
+		x, ok := r.read(bits.Len64(product - 1))
+		if !ok || x >= product {
+			return errPermutationEncoding
+		}
+		// ceil(x * 2^64 / product) lies in [x/product, (x+1)/product) as
+		// a fraction of 2^64, whose mixed-radix digits are those of x.
+		word, rem := bits.Div64(x, 0, product)
+		if rem != 0 {
+			word++
+		}
+		batchIndices(n, k, word, &digits)
+		for j, digit := range digits[:k] {
+			code[pos+j] = int(digit)
+		}
+		pos += k
+	}
+	if !r.done() {
+		return errPermutationEncoding
+	}
+	perm, err := PermutationFromLehmerCode(code)
+	if err != nil {
+		return errPermutationEncoding
+	}
+	*p = perm
+	return nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface, with the
+// binary encoding in base64. Permutations thus encode to compact JSON
+// strings.
+func (p Permutation) MarshalText() ([]byte, error) {
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.AppendEncode(nil, data), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (p *Permutation) UnmarshalText(text []byte) error {
+	data, err := base64.StdEncoding.AppendDecode(nil, text)
+	if err != nil {
+		return errPermutationEncoding
+	}
+	return p.UnmarshalBinary(data)
+}
+
+// bitWriter appends values of up to 64 bits to buf, least significant bit
+// first.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	count int // bits in acc, fewer than 8 between writes
+}
+
+func (w *bitWriter) write(v uint64, width int) {
+	if width > 32 {
+		w.write(v&(1<<32-1), 32)
+		v, width = v>>32, width-32
+	}
+	w.acc |= v << w.count
+	w.count += width
+	for w.count >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.count -= 8
+	}
+}
+
+// flush returns buf with the last, zero-padded, byte.
+func (w *bitWriter) flush() []byte {
+	if w.count > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+	}
+	return w.buf
+}
+
+// bitReader reads the values written by a bitWriter.
+type bitReader struct {
+	buf   []byte
+	acc   uint64
+	count int // bits in acc
+}
+
+func (r *bitReader) read(width int) (uint64, bool) {
+	if width > 32 {
+		lo, ok := r.read(32)
+		hi, ok2 := r.read(width - 32)
+		return lo | hi<<32, ok && ok2
+	}
+	for r.count < width {
+		if len(r.buf) == 0 {
+			return 0, false
+		}
+		r.acc |= uint64(r.buf[0]) << r.count
+		r.buf = r.buf[1:]
+		r.count += 8
+	}
+	v := r.acc & (1<<width - 1)
+	r.acc >>= width
+	r.count -= width
+	return v, true
+}
+
+// done reports whether all of buf was read, and the padding bits are zero.
+func (r *bitReader) done() bool {
+	return len(r.buf) == 0 && r.acc == 0
+}
@@ -0,0 +1,173 @@
+package batchedrand
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestLehmerCode(t *testing.T) {
+	p := Permutation{2, 0, 3, 1}
+	want := []int{2, 0, 1, 0}
+	if got := p.LehmerCode(); !slices.Equal(got, want) {
+		t.Errorf("%v.LehmerCode() = %v, expected %v", p, got, want)
+	}
+	rng := New(rand.NewPCG(1, 2))
+	for _, size := range []int{0, 1, 2, 10, 1000} {
+		p := rng.RandomPermutation(size)
+		code := p.LehmerCode()
+		// Check against the definition.
+		for k := range p {
+			count := 0
+			for j := k + 1; j < len(p); j++ {
+				if p[j] < p[k] {
+					count++
+				}
+			}
+			if code[k] != count {
+				t.Fatalf("digit %d of the Lehmer code of %v is %d, expected %d", k, p, code[k], count)
+			}
+		}
+		got, err := PermutationFromLehmerCode(code)
+		if err != nil || !slices.Equal(got, p) {
+			t.Fatalf("PermutationFromLehmerCode(%v) = %v, %v; expected %v", code, got, err, p)
+		}
+	}
+	for _, bad := range [][]int{{1}, {0, 1}, {3, 0, 0}, {-1, 0}} {
+		if _, err := PermutationFromLehmerCode(bad); err != errLehmerDigit {
+			t.Errorf("PermutationFromLehmerCode(%v) returned %v", bad, err)
+		}
+	}
+}
+
+func TestPermutation_BinaryAllOfFive(t *testing.T) {
+	// The encodings of the 120 permutations of 5 elements are distinct,
+	// and decode to them.
+	seen := make(map[string]bool)
+	for rank := 0; rank < 120; rank++ {
+		code := make([]int, 5)
+		for k, r := 0, rank; k < 5; k++ {
+			code[k], r = r%(5-k), r/(5-k)
+		}
+		p, err := PermutationFromLehmerCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 2 {
+			t.Errorf("%v encodes to %d bytes, expected 2", p, len(data))
+		}
+		seen[string(data)] = true
+		var got Permutation
+		if err := got.UnmarshalBinary(data); err != nil || !slices.Equal(got, p) {
+			t.Fatalf("UnmarshalBinary(%x) = %v, %v; expected %v", data, got, err, p)
+		}
+	}
+	if len(seen) != 120 {
+		t.Errorf("%d distinct encodings, expected 120", len(seen))
+	}
+}
+
+func TestPermutation_BinaryRoundTrip(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{9}))
+	sizes := []int{0, 1, 2, 3, 12, 13, 20, 21, 52, 1000, 100000}
+	for size := 4; size < 40; size++ {
+		sizes = append(sizes, size)
+	}
+	for _, size := range sizes {
+		p := rng.RandomPermutation(size)
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// About log2(n!) bits, plus less than one bit per group of up to
+		// maxBatch digits, and the size.
+		lg, _ := math.Lgamma(float64(size + 1))
+		if limit := (lg/math.Ln2+float64(size/2+1))/8 + 4; float64(len(data)) > limit {
+			t.Errorf("size %d: %d bytes, expected at most %.0f", size, len(data), limit)
+		}
+		var got Permutation
+		if err := got.UnmarshalBinary(data); err != nil || !slices.Equal(got, p) {
+			t.Fatalf("size %d: binary round trip failed: %v", size, err)
+		}
+		if data, err = p.AppendBinary([]byte("prefix")); err != nil || string(data[:6]) != "prefix" {
+			t.Fatalf("size %d: AppendBinary = %q..., %v", size, data[:6], err)
+		}
+	}
+}
+
+func TestPermutation_JSON(t *testing.T) {
+	type deal struct {
+		Game int
+		Deck Permutation
+	}
+	want := deal{Game: 7, Deck: New(rand.NewPCG(1, 2)).RandomPermutation(52)}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The deck encodes to a base64 string of 1+29 bytes.
+	if len(data) > len(`{"Game":7,"Deck":""}`)+40 {
+		t.Errorf("JSON encoding is %d bytes: %s", len(data), data)
+	}
+	var got deal
+	if err := json.Unmarshal(data, &got); err != nil || got.Game != want.Game || !slices.Equal(got.Deck, want.Deck) {
+		t.Errorf("JSON round trip of %s = %v, %v", data, got, err)
+	}
+}
+
+func TestPermutation_BinaryInvalid(t *testing.T) {
+	if _, err := (Permutation{0, 0}).MarshalBinary(); err != errPermutationRepeat {
+		t.Errorf("MarshalBinary of an invalid permutation returned %v", err)
+	}
+	valid, err := Permutation{3, 1, 2, 0}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][]byte{
+		nil,
+		{0x80},                   // truncated size
+		{4},                      // truncated code
+		append(valid, 0),         // trailing byte
+		{3, 7},                   // 7 >= 3! = 6
+		{3, 0x08},                // non-zero padding
+		{0xff, 0xff, 0xff, 0x0f}, // forged size
+		{0x81, 0x01, 0xff, 0xff}, // 129 elements in 2 bytes
+	} {
+		p := Permutation{1, 0}
+		if err := p.UnmarshalBinary(bad); err != errPermutationEncoding {
+			t.Errorf("UnmarshalBinary(%x) returned %v", bad, err)
+		}
+		if !slices.Equal(p, Permutation{1, 0}) {
+			t.Errorf("UnmarshalBinary(%x) modified the permutation to %v", bad, p)
+		}
+	}
+	var p Permutation
+	if err := p.UnmarshalText([]byte("not base64!")); err != errPermutationEncoding {
+		t.Errorf("UnmarshalText returned %v", err)
+	}
+}
+
+func BenchmarkPermutationBinary(b *testing.B) {
+	for _, size := range []int{52, 1000} {
+		p := New(rand.NewPCG(1, 2)).RandomPermutation(size)
+		data, _ := p.MarshalBinary()
+		b.Run(fmt.Sprintf("Marshal_size_%d", size), func(b *testing.B) {
+			for b.Loop() {
+				p.MarshalBinary()
+			}
+		})
+		b.Run(fmt.Sprintf("Unmarshal_size_%d", size), func(b *testing.B) {
+			var q Permutation
+			for b.Loop() {
+				q.UnmarshalBinary(data)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package batchedrand
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+)
+
+// minParallelShuffle is the smallest slice ParallelShuffle splits across
+// workers; below it, the cost of starting goroutines dominates.
+const minParallelShuffle = 1 << 16
+
+// ParallelShuffle pseudo-randomizes the order of the elements of s using up
+// to workers goroutines; if workers <= 0, GOMAXPROCS is used. Each element
+// is first scattered into a uniformly chosen bucket, then every bucket is
+// shuffled independently (the Rao-Sandelius method), which yields a
+// uniformly random permutation. Each worker draws from its own child
+// source. For a Rand returned by NewSecure, the children read from
+// crypto/rand too; otherwise they are PCG generators seeded from r, so the
+// result is reproducible for a given state of r and a given number of
+// workers. The buckets are shuffled with the thresholds of r. ParallelShuffle
+// uses a scratch copy of s. Small slices are shuffled sequentially with r.
+func ParallelShuffle[T any](r *Rand, s []T, workers int) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(s)/minParallelShuffle)
+	if workers <= 1 {
+		src, levels := r.shuffleSource()
+		shuffleSlice(src, s, levels)
+		return
+	}
+	parallelShuffle(r, s, workers)
+}
+
+// parallelShuffle implements ParallelShuffle with exactly workers workers
+// and workers buckets.
+func parallelShuffle[T any](r *Rand, s []T, workers int) {
+	n := len(s)
+	buckets := workers
+	src, levels := r.shuffleSource()
+	// The children of a secure source are secure sources too. They cannot
+	// be replayed, so the labels they draw are stored rather than
+	// regenerated, and they need no seeds.
+	secure, isSecure := src.(*secureSource)
+	childSource := func(seed [2]uint64) rand.Source {
+		if isSecure {
+			return &secureSource{reader: secure.reader}
+		}
+		return rand.NewPCG(seed[0], seed[1])
+	}
+	// Child seeds are drawn up front so that the result does not depend on
+	// goroutine scheduling.
+	labelSeeds := make([][2]uint64, workers)
+	shuffleSeeds := make([][2]uint64, buckets)
+	if !isSecure {
+		for w := range labelSeeds {
+			labelSeeds[w] = [2]uint64{r.Uint64(), r.Uint64()}
+		}
+		for b := range shuffleSeeds {
+			shuffleSeeds[b] = [2]uint64{r.Uint64(), r.Uint64()}
+		}
+	}
+	chunk := func(w int) []T {
+		return s[w*n/workers : (w+1)*n/workers]
+	}
+	var stored [][]uint32
+	if isSecure {
+		stored = make([][]uint32, workers)
+	}
+	// labels calls f with the bucket of every element of chunk w, in order.
+	// The labels are regenerated from the same seed on every call, or, for
+	// a secure source, stored on the first call.
+	labels := func(w int, f func(i int, b uint64)) {
+		if stored != nil && stored[w] != nil {
+			for i, b := range stored[w] {
+				f(i, uint64(b))
+			}
+			return
+		}
+		child := New(childSource(labelSeeds[w]))
+		k := batchSize(uint64(buckets))
+		var pending [MaxDistinct]uint64
+		m := len(chunk(w))
+		if stored != nil {
+			stored[w] = make([]uint32, 0, m)
+		}
+		for i := 0; i < m; i += k {
+			child.batchedUniform(uint64(buckets), pending[:k])
+			for j, b := range pending[:min(k, m-i)] {
+				if stored != nil {
+					stored[w] = append(stored[w], uint32(b))
+				}
+				f(i+j, b)
+			}
+		}
+	}
+	parallel := func(f func(w int)) {
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Go(func() { f(w) })
+		}
+		wg.Wait()
+	}
+
+	// Count the elements each worker sends to each bucket.
+	counts := make([][]int, workers)
+	parallel(func(w int) {
+		counts[w] = make([]int, buckets)
+		labels(w, func(_ int, b uint64) {
+			counts[w][b]++
+		})
+	})
+	// Bucket b occupies starts[b]:starts[b+1], in which the elements from
+	// worker w follow those from workers 0, ..., w-1.
+	starts := make([]int, buckets+1)
+	offsets := make([][]int, workers)
+	for w := range offsets {
+		offsets[w] = make([]int, buckets)
+	}
+	for b := 0; b < buckets; b++ {
+		pos := starts[b]
+		for w := 0; w < workers; w++ {
+			offsets[w][b] = pos
+			pos += counts[w][b]
+		}
+		starts[b+1] = pos
+	}
+
+	scratch := make([]T, n)
+	parallel(func(w int) {
+		c := chunk(w)
+		off := offsets[w]
+		labels(w, func(i int, b uint64) {
+			scratch[off[b]] = c[i]
+			off[b]++
+		})
+	})
+	parallel(func(b int) {
+		dst := s[starts[b]:starts[b+1]]
+		copy(dst, scratch[starts[b]:starts[b+1]])
+		shuffleSlice(childSource(shuffleSeeds[b]), dst, levels)
+	})
+}
@@ -0,0 +1,78 @@
+package batchedrand
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestParallelShuffle_Permutation(t *testing.T) {
+	for _, size := range []int{0, 1, 1000, minParallelShuffle * 5} {
+		for _, workers := range []int{0, 1, 3, 8} {
+			rng := New(rand.NewPCG(1, 2))
+			data := getSlice(size)
+			ParallelShuffle(rng, data, workers)
+			if size > 100 && slices.Equal(data, getSlice(size)) {
+				t.Fatalf("size %d, %d workers: data was not shuffled", size, workers)
+			}
+			slices.Sort(data)
+			if !slices.Equal(data, getSlice(size)) {
+				t.Fatalf("size %d, %d workers: result is not a permutation", size, workers)
+			}
+		}
+	}
+}
+
+func TestParallelShuffle_Reproducible(t *testing.T) {
+	const size = minParallelShuffle * 4
+	var results [2][]int
+	for i := range results {
+		rng := New(rand.NewPCG(1, 2))
+		results[i] = getSlice(size)
+		ParallelShuffle(rng, results[i], 4)
+	}
+	if !slices.Equal(results[0], results[1]) {
+		t.Fatalf("same seed and worker count gave different results")
+	}
+}
+
+func TestParallelShuffle_Secure(t *testing.T) {
+	const size = minParallelShuffle * 4
+	reader := &countingReader{r: cryptorand.Reader}
+	rng := New(&secureSource{reader: reader})
+	data := getSlice(size)
+	ParallelShuffle(rng, data, 4)
+	slices.Sort(data)
+	if !slices.Equal(data, getSlice(size)) {
+		t.Fatalf("result is not a permutation")
+	}
+	// The bucket shuffles alone draw at least one word per maxBatch
+	// elements, from blocks of secureWords words; seeding PCG children
+	// would take a single read.
+	if minReads := size / (maxBatch * secureWords); reader.reads < minReads {
+		t.Errorf("%d entropy reads, expected at least %d: the children are not secure", reader.reads, minReads)
+	}
+}
+
+func TestParallelShuffle_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	// Force the bucketed algorithm on a tiny slice.
+	checkShuffleUniform(t, "parallelShuffle", 4, 24*2000, func(data []int) {
+		parallelShuffle(rng, data, 3)
+	})
+}
+
+func BenchmarkParallelShuffle(b *testing.B) {
+	const size = 1 << 22
+	data := getSlice(size)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			rng := New(rand.NewPCG(1, 2))
+			for i := 0; i < b.N; i++ {
+				ParallelShuffle(rng, data, workers)
+			}
+		})
+	}
+}
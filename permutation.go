@@ -0,0 +1,202 @@
+package batchedrand
+
+import "errors"
+
+// A Permutation of n elements lists, for each index k, the index p[k]
+// whose element moves to index k when p is applied: applying p to s gives
+// s'[k] = s[p[k]]. It must hold each of 0, 1, ..., n-1 exactly once (see
+// Validate); the methods do not check it.
+type Permutation []int
+
+// Errors returned by Permutation.Validate.
+var (
+	errPermutationRange  = errors.New("invalid permutation: index out of range")
+	errPermutationRepeat = errors.New("invalid permutation: repeated index")
+)
+
+// identity returns the identity permutation of n elements.
+func identity(n int) Permutation {
+	p := make(Permutation, n)
+	for i := range p {
+		p[i] = i
+	}
+	return p
+}
+
+// RandomPermutation returns a uniformly random permutation of n elements.
+// It panics if n < 0.
+func (r *Rand) RandomPermutation(n int) Permutation {
+	if n < 0 {
+		panic("invalid argument to RandomPermutation")
+	}
+	p := identity(n)
+	r.Shuffle(n, func(i, j int) {
+		p[i], p[j] = p[j], p[i]
+	})
+	return p
+}
+
+// RandomEvenPermutation returns a uniformly random even permutation of n
+// elements. It panics if n < 0.
+func (r *Rand) RandomEvenPermutation(n int) Permutation {
+	if n < 0 {
+		panic("invalid argument to RandomEvenPermutation")
+	}
+	p := r.RandomPermutation(n)
+	// Swapping two values is a bijection between the odd and the even
+	// permutations.
+	if p.Parity() == 1 {
+		p[0], p[1] = p[1], p[0]
+	}
+	return p
+}
+
+// RandomPermutationOfType returns a uniformly random permutation among
+// those whose cycles have the given lengths (fixed points are cycles of
+// length 1), of as many elements as the sum of the lengths. It panics if
+// a length is less than 1.
+func (r *Rand) RandomPermutationOfType(cycleLengths ...int) Permutation {
+	n := 0
+	for _, length := range cycleLengths {
+		if length < 1 {
+			panic("invalid argument to RandomPermutationOfType")
+		}
+		n += length
+	}
+	// Cutting a uniformly random arrangement into cycles of the given
+	// lengths gives each permutation of that type from the same number of
+	// arrangements: one per rotation of each cycle, and per exchange of
+	// cycles of the same length.
+	order := r.RandomPermutation(n)
+	p := make(Permutation, n)
+	for _, length := range cycleLengths {
+		cycle := order[:length]
+		for i, k := range cycle {
+			p[k] = cycle[(i+1)%length]
+		}
+		order = order[length:]
+	}
+	return p
+}
+
+// Validate reports whether p holds each of 0, 1, ..., len(p)-1 exactly
+// once.
+func (p Permutation) Validate() error {
+	seen := make([]bool, len(p))
+	for _, v := range p {
+		if v < 0 || v >= len(p) {
+			return errPermutationRange
+		}
+		if seen[v] {
+			return errPermutationRepeat
+		}
+		seen[v] = true
+	}
+	return nil
+}
+
+// Apply applies p through swap, in at most len(p)-1 swaps: afterwards,
+// index k holds the element that was at index p[k].
+func (p Permutation) Apply(swap func(i, j int)) {
+	visited := make([]bool, len(p))
+	for start := range p {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		for k := start; p[k] != start; k = p[k] {
+			swap(k, p[k])
+			visited[p[k]] = true
+		}
+	}
+}
+
+// ApplyInverse undoes Apply: afterwards, index p[k] holds the element that
+// was at index k.
+func (p Permutation) ApplyInverse(swap func(i, j int)) {
+	visited := make([]bool, len(p))
+	for start := range p {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		for k := p[start]; k != start; k = p[k] {
+			swap(start, k)
+			visited[k] = true
+		}
+	}
+}
+
+// Inverse returns the inverse of p, which undoes it.
+func (p Permutation) Inverse() Permutation {
+	q := make(Permutation, len(p))
+	for k, v := range p {
+		q[v] = k
+	}
+	return q
+}
+
+// Compose returns the permutation that applies p, then q. It panics if p
+// and q have different lengths.
+func (p Permutation) Compose(q Permutation) Permutation {
+	if len(p) != len(q) {
+		panic("invalid argument to Compose")
+	}
+	c := make(Permutation, len(p))
+	for k, v := range q {
+		c[k] = p[v]
+	}
+	return c
+}
+
+// Cycles returns the cycles of p, fixed points included: each cycle starts
+// with its smallest index k, followed by p[k], p[p[k]], and so on. The
+// cycles are in order of their first index.
+func (p Permutation) Cycles() [][]int {
+	var cycles [][]int
+	visited := make([]bool, len(p))
+	for start := range p {
+		if visited[start] {
+			continue
+		}
+		cycle := []int{start}
+		visited[start] = true
+		for k := p[start]; k != start; k = p[k] {
+			cycle = append(cycle, k)
+			visited[k] = true
+		}
+		cycles = append(cycles, cycle)
+	}
+	return cycles
+}
+
+// Parity returns 0 if p is even (a product of an even number of
+// transpositions), and 1 if it is odd.
+func (p Permutation) Parity() int {
+	// A cycle of length l is a product of l-1 transpositions.
+	transpositions := 0
+	visited := make([]bool, len(p))
+	for start := range p {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		for k := p[start]; k != start; k = p[k] {
+			transpositions++
+			visited[k] = true
+		}
+	}
+	return transpositions % 2
+}
+
+// FixedPoints returns the indices k such that p[k] = k, in increasing
+// order.
+func (p Permutation) FixedPoints() []int {
+	var fixed []int
+	for k, v := range p {
+		if k == v {
+			fixed = append(fixed, k)
+		}
+	}
+	return fixed
+}
@@ -0,0 +1,155 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestPermutation_Validate(t *testing.T) {
+	for _, valid := range []Permutation{nil, {0}, {1, 0}, {2, 0, 1}, identity(100)} {
+		if err := valid.Validate(); err != nil {
+			t.Errorf("%v: %v", valid, err)
+		}
+	}
+	for _, tc := range []struct {
+		p    Permutation
+		want error
+	}{
+		{Permutation{1}, errPermutationRange},
+		{Permutation{0, -1}, errPermutationRange},
+		{Permutation{0, 2, 1, 4}, errPermutationRange},
+		{Permutation{1, 1}, errPermutationRepeat},
+		{Permutation{2, 0, 2}, errPermutationRepeat},
+	} {
+		if err := tc.p.Validate(); err != tc.want {
+			t.Errorf("%v: got %v, expected %v", tc.p, err, tc.want)
+		}
+	}
+}
+
+// applied returns s with p applied, computed from the definition.
+func applied(p Permutation, s []int) []int {
+	out := make([]int, len(s))
+	for k, v := range p {
+		out[k] = s[v]
+	}
+	return out
+}
+
+func TestPermutation_Algebra(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	for _, size := range []int{0, 1, 2, 7, 100} {
+		for trial := 0; trial < 50; trial++ {
+			p, q := rng.RandomPermutation(size), rng.RandomPermutation(size)
+			if err := p.Validate(); err != nil {
+				t.Fatalf("RandomPermutation(%d) = %v: %v", size, p, err)
+			}
+			data := rng.RandomPermutation(size) // arbitrary distinct values
+			got := slices.Clone([]int(data))
+			swaps := 0
+			p.Apply(func(i, j int) {
+				got[i], got[j] = got[j], got[i]
+				swaps++
+			})
+			if want := applied(p, data); !slices.Equal(got, want) {
+				t.Fatalf("%v.Apply gives %v, expected %v", p, got, want)
+			}
+			if size > 0 && swaps > size-1 {
+				t.Errorf("%v.Apply made %d swaps", p, swaps)
+			}
+			p.ApplyInverse(func(i, j int) {
+				got[i], got[j] = got[j], got[i]
+			})
+			if !slices.Equal(got, data) {
+				t.Fatalf("%v.ApplyInverse did not undo Apply", p)
+			}
+			if got := applied(p.Inverse(), applied(p, data)); !slices.Equal(got, data) {
+				t.Fatalf("%v.Inverse() = %v does not undo it", p, p.Inverse())
+			}
+			if got, want := applied(p.Compose(q), data), applied(q, applied(p, data)); !slices.Equal(got, want) {
+				t.Fatalf("%v.Compose(%v) gives %v, expected %v", p, q, got, want)
+			}
+		}
+	}
+}
+
+func TestPermutation_Cycles(t *testing.T) {
+	p := Permutation{1, 2, 0, 3, 5, 4}
+	want := [][]int{{0, 1, 2}, {3}, {4, 5}}
+	if got := p.Cycles(); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("Cycles() = %v, expected %v", got, want)
+	}
+	if got := p.FixedPoints(); !slices.Equal(got, []int{3}) {
+		t.Errorf("FixedPoints() = %v, expected [3]", got)
+	}
+	if got := p.Parity(); got != 1 {
+		t.Errorf("Parity() = %d, expected 1", got)
+	}
+
+	// The parity is that of the number of inversions.
+	rng := New(rand.NewPCG(3, 4))
+	for trial := 0; trial < 200; trial++ {
+		p := rng.RandomPermutation(1 + trial%13)
+		inversions := 0
+		for i := range p {
+			for j := i + 1; j < len(p); j++ {
+				if p[i] > p[j] {
+					inversions++
+				}
+			}
+		}
+		if got := p.Parity(); got != inversions%2 {
+			t.Fatalf("%v.Parity() = %d with %d inversions", p, got, inversions)
+		}
+	}
+}
+
+func TestRandomEvenPermutation(t *testing.T) {
+	rng := New(rand.NewPCG(5, 6))
+	for _, size := range []int{0, 1, 2} {
+		if p := rng.RandomEvenPermutation(size); !slices.Equal(p, identity(size)) {
+			t.Errorf("RandomEvenPermutation(%d) = %v", size, p)
+		}
+	}
+	checkUniform(t, "RandomEvenPermutation(5)", 60, 60*200, func() Permutation {
+		p := rng.RandomEvenPermutation(5)
+		if p.Parity() != 0 {
+			t.Fatalf("%v is odd", p)
+		}
+		return p
+	})
+	defer func() {
+		if msg := recover(); msg != "invalid argument to RandomEvenPermutation" {
+			t.Errorf("RandomEvenPermutation(-1) panicked with %v", msg)
+		}
+	}()
+	rng.RandomEvenPermutation(-1)
+}
+
+func TestRandomPermutationOfType(t *testing.T) {
+	rng := New(rand.NewPCG(7, 8))
+	for _, tc := range []struct {
+		lengths  []int
+		numPerms int
+	}{
+		{[]int{5}, 24},
+		{[]int{2, 2, 1}, 15},
+		{[]int{1, 3, 1}, 20},
+		{[]int{1, 1, 1, 1}, 1},
+	} {
+		want := slices.Sorted(slices.Values(tc.lengths))
+		checkUniform(t, fmt.Sprint(tc.lengths), tc.numPerms, tc.numPerms*200, func() Permutation {
+			p := rng.RandomPermutationOfType(tc.lengths...)
+			var lengths []int
+			for _, cycle := range p.Cycles() {
+				lengths = append(lengths, len(cycle))
+			}
+			if slices.Sort(lengths); !slices.Equal(lengths, want) {
+				t.Fatalf("%v has cycles %v, expected lengths %v", p, p.Cycles(), tc.lengths)
+			}
+			return p
+		})
+	}
+}
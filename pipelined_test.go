@@ -0,0 +1,107 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// pipelineLength is the number of indices shufflePipelined generates
+// before performing the corresponding swaps.
+const pipelineLength = 256
+
+// shufflePipelined is an experimental variant of shuffleLevels, kept for
+// BenchmarkPipelined only, that decouples index generation from swapping:
+// it first computes a block of pipelineLength batched indices into a stack
+// buffer, with drawBatch on the words of r, then performs the swaps. The
+// multiply chains of consecutive batches no longer wait on the swaps, and
+// the swap targets of a block are known before the first of them is
+// touched. n must not exceed levels[0].max.
+//
+// On an Intel Xeon server, BenchmarkPipelined shows it 75% to 125% slower
+// than shuffleLevel, the generic kernel, which calls Uint64 through the
+// same interface, for both ChaCha8 and PCG: the calls to drawBatch and the
+// store and reload of the indices cost more than the parallelism gained. It does not touch the
+// upcoming swap targets early: the elements are only reachable through the
+// swap callback, and Go has no prefetch intrinsic.
+func shufflePipelined[S uint64Source](r S, n uint64, levels []batchLevel, swap func(i, j int)) {
+	var indexes [pipelineLength]uint64
+	var batch [maxBatch]uint64
+	level := 0
+	for n > 1 {
+		// Fill indexes with targets for positions n-1, n-2, ..., n-m.
+		m := 0
+		bound := n
+		for m <= pipelineLength-maxBatch && bound > 1 {
+			for bound <= levels[level].threshold {
+				level++
+			}
+			k := min(levels[level].k, int(bound-1))
+			drawBatch(r, bound, k, levels[level].bound, &batch)
+			m += copy(indexes[m:], batch[:k])
+			bound -= uint64(k)
+		}
+		for _, index := range indexes[:m] {
+			n--
+			swap(int(n), int(index))
+		}
+	}
+}
+
+func TestShufflePipelined(t *testing.T) {
+	src := rand.NewPCG(1, 2)
+	for _, size := range []int{0, 1, 2, 7, 300, 1000, 100000} {
+		data := getSlice(size)
+		shufflePipelined(src, uint64(len(data)), batchLevels64, func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+		slices.Sort(data)
+		if !slices.Equal(data, getSlice(size)) {
+			t.Fatalf("size %d: result is not a permutation", size)
+		}
+	}
+	checkShuffleUniform(t, "shufflePipelined", 4, 24*2000, func(data []int) {
+		shufflePipelined(src, uint64(len(data)), batchLevels64, func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+	})
+}
+
+func BenchmarkPipelined(b *testing.B) {
+	sources := map[string]func() rand.Source{
+		"ChaCha": func() rand.Source { return rand.NewChaCha8([32]byte{1, 2, 3}) },
+		"PCG":    func() rand.Source { return rand.NewPCG(1, 2) },
+	}
+	for _, name := range []string{"ChaCha", "PCG"} {
+		for _, size := range []int{30, 100, 500000} {
+			b.Run(fmt.Sprintf("%s/Batched_size_%d", name, size), func(b *testing.B) {
+				rng := New(sources[name]())
+				data := getSlice(size)
+				for i := 0; i < b.N; i++ {
+					rng.Shuffle(len(data), func(i, j int) {
+						data[i], data[j] = data[j], data[i]
+					})
+				}
+			})
+			b.Run(fmt.Sprintf("%s/Generic_size_%d", name, size), func(b *testing.B) {
+				src := sources[name]()
+				data := getSlice(size)
+				for i := 0; i < b.N; i++ {
+					shuffleLevelsSingle(src, uint64(len(data)), batchLevels64, func(i, j int) {
+						data[i], data[j] = data[j], data[i]
+					})
+				}
+			})
+			b.Run(fmt.Sprintf("%s/Pipelined_size_%d", name, size), func(b *testing.B) {
+				src := sources[name]()
+				data := getSlice(size)
+				for i := 0; i < b.N; i++ {
+					shufflePipelined(src, uint64(len(data)), batchLevels64, func(i, j int) {
+						data[i], data[j] = data[j], data[i]
+					})
+				}
+			})
+		}
+	}
+}
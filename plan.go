@@ -0,0 +1,92 @@
+package batchedrand
+
+// A Plan is a recorded random permutation, which can be applied to several
+// arrays (features and labels, keys and values) so that they are shuffled
+// the same way, and undone later.
+//
+// A Plan stores the Fisher-Yates swap target of each position: 4 bytes per
+// element below 2^32 elements, 8 bytes beyond. It is safe for concurrent
+// use, as it is never modified.
+type Plan struct {
+	n int
+	// targets[i] (or targets64[i] for n > 2^32) is the target of position
+	// i, in [0, i]; targets[0] is unused.
+	targets   []uint32
+	targets64 []uint64
+}
+
+// NewPlan returns a uniformly random plan for n elements, drawing its swap
+// targets as Shuffle does. It panics if n < 0.
+func (r *Rand) NewPlan(n int) *Plan {
+	if n < 0 {
+		panic("invalid argument to NewPlan")
+	}
+	p := &Plan{n: n}
+	if uint64(n) <= 1<<32 {
+		p.targets = make([]uint32, n)
+		r.Shuffle(n, func(i, j int) {
+			p.targets[i] = uint32(j)
+		})
+	} else {
+		p.targets64 = make([]uint64, n)
+		r.Shuffle(n, func(i, j int) {
+			p.targets64[i] = uint64(j)
+		})
+	}
+	return p
+}
+
+// Len returns the number of elements of the plan.
+func (p *Plan) Len() int {
+	return p.n
+}
+
+// target returns the swap target of position i.
+func (p *Plan) target(i int) int {
+	if p.targets != nil {
+		return int(p.targets[i])
+	}
+	return int(p.targets64[i])
+}
+
+// Apply performs the swaps of the plan: swap(i, j) for i from Len()-1 down
+// to 1. Applied to arrays in the same initial order, it leaves them in the
+// same shuffled order.
+func (p *Plan) Apply(swap func(i, j int)) {
+	for i := p.n - 1; i > 0; i-- {
+		swap(i, p.target(i))
+	}
+}
+
+// Invert undoes Apply: it performs the same swaps in reverse order.
+func (p *Plan) Invert(swap func(i, j int)) {
+	for i := 1; i < p.n; i++ {
+		swap(i, p.target(i))
+	}
+}
+
+// ApplySlice applies p to s, which must have p.Len() elements.
+func ApplySlice[T any](p *Plan, s []T) {
+	if len(s) != p.n {
+		panic("invalid argument to ApplySlice")
+	}
+	if p.targets != nil {
+		for i := p.n - 1; i > 0; i-- {
+			j := p.targets[i]
+			s[i], s[j] = s[j], s[i]
+		}
+		return
+	}
+	for i := p.n - 1; i > 0; i-- {
+		j := p.targets64[i]
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// Permutation returns the permutation of the plan: after Apply, index k
+// holds the element that was at index Permutation()[k].
+func (p *Plan) Permutation() Permutation {
+	perm := identity(p.n)
+	ApplySlice(p, perm)
+	return perm
+}
@@ -0,0 +1,75 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestPlan_Uniform(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	for _, size := range []int{5, 30} {
+		// For size 30, count (value, position) pairs instead of permutations.
+		const numTrials = 24000
+		counts := make(map[string]int)
+		for trial := 0; trial < numTrials; trial++ {
+			perm := rng.NewPlan(size).Permutation()
+			if size <= 5 {
+				counts[fmt.Sprint(perm)]++
+				continue
+			}
+			for k, v := range perm {
+				counts[fmt.Sprint(k, v)]++
+			}
+		}
+		cells, outcomes := size*size, numTrials*size
+		if size <= 5 {
+			cells, outcomes = int(factorials[size]), numTrials
+		}
+		checkChiSquared(t, fmt.Sprintf("size %d", size), counts, cells, outcomes)
+	}
+}
+
+func TestPlan_ApplyInvert(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{7}))
+	for _, size := range []int{0, 1, 2, 20, 21, 1000, 100000} {
+		p := rng.NewPlan(size)
+		if p.Len() != size {
+			t.Fatalf("Len() = %d, expected %d", p.Len(), size)
+		}
+		keys := getSlice(size)
+		values := make([]string, size)
+		for i := range values {
+			values[i] = fmt.Sprint(i)
+		}
+		p.Apply(func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+		ApplySlice(p, values)
+		perm := p.Permutation()
+		for k := range keys {
+			if keys[k] != perm[k] || values[k] != fmt.Sprint(perm[k]) {
+				t.Fatalf("size %d: index %d holds %d and %q, expected %d", size, k, keys[k], values[k], perm[k])
+			}
+		}
+		if sorted := slices.Sorted(slices.Values(perm)); !slices.Equal(sorted, getSlice(size)) {
+			t.Fatalf("size %d: Permutation() is not a permutation", size)
+		}
+		p.Invert(func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+		if !slices.Equal(keys, getSlice(size)) {
+			t.Errorf("size %d: Invert did not undo Apply", size)
+		}
+	}
+}
+
+func TestApplySlice_Length(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("ApplySlice accepted a slice of the wrong length")
+		}
+	}()
+	ApplySlice(New(rand.NewPCG(1, 2)).NewPlan(10), make([]int, 9))
+}
@@ -0,0 +1,150 @@
+package batchedrand
+
+import "math/bits"
+
+// batchedIndices fills dst with independent uniform values such that
+// dst[j] lies in [0, n-j). All of dst is derived from a single random word
+// (plus rare rejections), drawn with drawBatch from the source of r, so the
+// caller must ensure that len(dst) <= maxBatch and that the product
+// n*(n-1)*...*(n-len(dst)+1) fits in 64 bits.
+func (r *Rand) batchedIndices(n uint64, dst []uint64) {
+	src, _ := r.shuffleSource()
+	// A rejection is only possible when the leftover is below the product,
+	// so the (slow) modulo is computed only in that case.
+	product := uint64(1)
+	for j := range dst {
+		product *= n - uint64(j)
+	}
+	var indexes [maxBatch]uint64
+	drawBatch(src, n, len(dst), product, &indexes)
+	copy(dst, indexes[:len(dst)])
+}
+
+// batchLength returns how many of the first k factors n, n-1, ..., n-k+1
+// can be multiplied together without exceeding 64 bits. It is at least 1
+// whenever k > 0.
+func batchLength(n uint64, k int) int {
+	product := uint64(1)
+	for j := 0; j < k; j++ {
+		hi, lo := bits.Mul64(product, n-uint64(j))
+		if hi != 0 {
+			if j == 0 {
+				return 1
+			}
+			return j
+		}
+		product = lo
+	}
+	return k
+}
+
+// rangedIndices fills dst with independent uniform values such that
+// dst[j] lies in [0, n-j), grouping as many draws per random word as the
+// 64-bit product allows.
+func (r *Rand) rangedIndices(n uint64, dst []uint64) {
+	for len(dst) > 0 {
+		m := batchLength(n, len(dst))
+		r.batchedIndices(n, dst[:m])
+		n -= uint64(m)
+		dst = dst[m:]
+	}
+}
+
+// batchedUniform fills dst with independent uniform values in [0, n), all
+// derived from a single random word (plus rare rejections). The caller must
+// ensure that n^len(dst) fits in 64 bits; batchSize(n) values always do.
+func (r *Rand) batchedUniform(n uint64, dst []uint64) {
+	src, _ := r.shuffleSource()
+	randVal := src.Uint64()
+	for j := range dst {
+		hi, lo := bits.Mul64(n, randVal)
+		randVal = lo
+		dst[j] = hi
+	}
+	product := uint64(1)
+	for range dst {
+		product *= n
+	}
+	if randVal < product {
+		t := (-product) % product
+		for randVal < t {
+			randVal = src.Uint64()
+			for j := range dst {
+				hi, lo := bits.Mul64(n, randVal)
+				randVal = lo
+				dst[j] = hi
+			}
+		}
+	}
+}
+
+// mul128 multiplies the 128-bit value (hi, lo) by a. It returns the top 64
+// bits of the 192-bit product and its low 128 bits.
+func mul128(a, hi, lo uint64) (top, newHi, newLo uint64) {
+	h0, l0 := bits.Mul64(a, lo)
+	h1, l1 := bits.Mul64(a, hi)
+	mid, carry := bits.Add64(h0, l1, 0)
+	return h1 + carry, mid, l0
+}
+
+// less128 reports whether the 128-bit value (aHi, aLo) is below (bHi, bLo).
+func less128(aHi, aLo, bHi, bLo uint64) bool {
+	return aHi < bHi || (aHi == bHi && aLo < bLo)
+}
+
+// mod128 returns (uHi, uLo) modulo the non-zero (vHi, vLo), all 128 bits.
+func mod128(uHi, uLo, vHi, vLo uint64) (rHi, rLo uint64) {
+	if vHi == 0 {
+		_, r := bits.Div64(0, uHi, vLo)
+		_, r = bits.Div64(r, uLo, vLo)
+		return 0, r
+	}
+	// The quotient fits in 64 bits. Estimate it from the top bits of v, as
+	// in Hacker's Delight (divlu for 128-bit operands): the estimate is
+	// exact or one too small.
+	s := uint(bits.LeadingZeros64(vHi))
+	v1 := vHi<<s | vLo>>(64-s)
+	q1, _ := bits.Div64(uHi>>1, uHi<<63|uLo>>1, v1)
+	q0 := q1 >> (63 - s)
+	if q0 != 0 {
+		q0--
+	}
+	// r = u - q0*v, which fits in 128 bits since q0*v <= u.
+	pHi, pLo := bits.Mul64(q0, vLo)
+	pHi += q0 * vHi
+	rLo, borrow := bits.Sub64(uLo, pLo, 0)
+	rHi, _ = bits.Sub64(uHi, pHi, borrow)
+	if !less128(rHi, rLo, vHi, vLo) {
+		rLo, borrow = bits.Sub64(rLo, vLo, 0)
+		rHi, _ = bits.Sub64(rHi, vHi, borrow)
+	}
+	return rHi, rLo
+}
+
+// batchedIndices128 is like batchedIndices, but derives dst from two
+// random words combined into a 128-bit value, so that the product
+// n*(n-1)*...*(n-len(dst)+1) need only fit in 128 bits. For n up to 2^40,
+// this gives three indices per two words where batchedIndices gives one
+// per word. (Two indices per two words would gain nothing.)
+func batchedIndices128[S uint64Source](src S, n uint64, dst []uint64) {
+	hi, lo := src.Uint64(), src.Uint64()
+	for j := range dst {
+		dst[j], hi, lo = mul128(n-uint64(j), hi, lo)
+	}
+	pHi, pLo := uint64(0), uint64(1)
+	for j := range dst {
+		_, pHi, pLo = mul128(n-uint64(j), pHi, pLo)
+	}
+	if less128(hi, lo, pHi, pLo) {
+		// t = 2^128 mod product, computed as (2^128 - product) mod product.
+		nLo, borrow := bits.Sub64(0, pLo, 0)
+		nHi, _ := bits.Sub64(0, pHi, borrow)
+		tHi, tLo := mod128(nHi, nLo, pHi, pLo)
+		for less128(hi, lo, tHi, tLo) {
+			hi, lo = src.Uint64(), src.Uint64()
+			for j := range dst {
+				dst[j], hi, lo = mul128(n-uint64(j), hi, lo)
+			}
+		}
+	}
+}
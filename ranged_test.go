@@ -0,0 +1,94 @@
+package batchedrand
+
+import (
+	"math/big"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestMod128(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	toBig := func(hi, lo uint64) *big.Int {
+		x := new(big.Int).SetUint64(hi)
+		return x.Lsh(x, 64).Or(x, new(big.Int).SetUint64(lo))
+	}
+	for i := 0; i < 100000; i++ {
+		uHi, uLo := rng.Uint64(), rng.Uint64()
+		// Exercise divisors of every magnitude.
+		vHi, vLo := rng.Uint64()>>rng.UintN(64), rng.Uint64()>>rng.UintN(64)
+		if i%2 == 0 {
+			vHi = 0
+		}
+		if vHi == 0 && vLo == 0 {
+			continue
+		}
+		rHi, rLo := mod128(uHi, uLo, vHi, vLo)
+		want := new(big.Int).Mod(toBig(uHi, uLo), toBig(vHi, vLo))
+		if toBig(rHi, rLo).Cmp(want) != 0 {
+			t.Fatalf("mod128(%#x:%#x, %#x:%#x) = %#x:%#x, expected %v", uHi, uLo, vHi, vLo, rHi, rLo, want)
+		}
+	}
+}
+
+func TestBatchedIndices128_Uniform(t *testing.T) {
+	src := rand.NewChaCha8([32]byte{1, 2, 3})
+	// Every triple with index j in [0, 5-j) should be equally likely.
+	counts := make(map[[3]uint64]int)
+	const numDraws = 60 * 2000
+	for i := 0; i < numDraws; i++ {
+		var indexes [3]uint64
+		batchedIndices128(src, 5, indexes[:])
+		counts[indexes]++
+	}
+	if len(counts) != 60 {
+		t.Fatalf("saw %d triples, expected 60", len(counts))
+	}
+	for triple, c := range counts {
+		if c < 1700 || c > 2300 {
+			t.Errorf("triple %v seen %d times, expected about 2000", triple, c)
+		}
+	}
+}
+
+func TestBatchedIndices128_Range(t *testing.T) {
+	src := rand.NewPCG(1, 2)
+	for _, n := range []uint64{1<<30 + 1, 1 << 35, 1 << 40} {
+		high := false
+		for i := 0; i < 1000; i++ {
+			var indexes [3]uint64
+			batchedIndices128(src, n, indexes[:])
+			for j, index := range indexes {
+				if index >= n-uint64(j) {
+					t.Fatalf("n=%d: index %d is %d", n, j, index)
+				}
+				if index >= n/2 {
+					high = true
+				}
+			}
+		}
+		if !high {
+			t.Errorf("n=%d: no index in the upper half of the range", n)
+		}
+	}
+}
+
+func BenchmarkBatchedIndices128(b *testing.B) {
+	// Three indices for an array of 2^35 elements, as drawn by Shuffle.
+	const n = 1 << 35
+	b.Run("Single", func(b *testing.B) {
+		r := New(rand.NewPCG(1, 2))
+		var indexes [3]uint64
+		for i := 0; i < b.N; i++ {
+			for j := range indexes {
+				r.batchedIndices(n-uint64(j), indexes[j:j+1])
+			}
+		}
+	})
+	b.Run("Batched128", func(b *testing.B) {
+		r := New(rand.NewPCG(1, 2))
+		var indexes [3]uint64
+		for i := 0; i < b.N; i++ {
+			batchedIndices128(r.Rand, n, indexes[:])
+		}
+	})
+}
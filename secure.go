@@ -0,0 +1,54 @@
+package batchedrand
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"sync"
+)
+
+// secureWords is the number of words a secure source reads from the
+// operating system at a time.
+const secureWords = 64
+
+// NewSecure returns a Rand whose random values come from crypto/rand,
+// for security-sensitive shuffles such as card dealing or audit sampling.
+// The batched algorithm draws several indices from each random word, and
+// words are read from the operating system a block at a time, so a
+// shuffle needs far fewer entropy reads than one per index.
+//
+// The returned Rand cannot be seeded and its output cannot be replayed.
+// Unlike other Rand values, it is safe for concurrent use by multiple
+// goroutines, except for SetThresholds.
+func NewSecure() *Rand {
+	return New(&secureSource{reader: cryptorand.Reader})
+}
+
+// secureSource is a rand.Source reading from crypto/rand through a buffer.
+// It deliberately has no Seed or MarshalBinary method.
+type secureSource struct {
+	mu     sync.Mutex
+	reader io.Reader // cryptorand.Reader, except in tests
+	buf    [8 * secureWords]byte
+	unread int // number of unread bytes at the end of buf
+}
+
+var _ rand.Source = (*secureSource)(nil)
+
+func (s *secureSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unread == 0 {
+		if _, err := io.ReadFull(s.reader, s.buf[:]); err != nil {
+			panic("batchedrand: reading secure random bytes: " + err.Error())
+		}
+		s.unread = len(s.buf)
+	}
+	pos := len(s.buf) - s.unread
+	x := binary.LittleEndian.Uint64(s.buf[pos:])
+	// Erase consumed words so that they cannot be recovered from memory.
+	clear(s.buf[pos : pos+8])
+	s.unread -= 8
+	return x
+}
@@ -0,0 +1,66 @@
+package batchedrand
+
+import (
+	cryptorand "crypto/rand"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// countingReader counts the reads made through it. It is safe for
+// concurrent use if r is.
+type countingReader struct {
+	r     io.Reader
+	mu    sync.Mutex
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	c.reads++
+	c.mu.Unlock()
+	return c.r.Read(p)
+}
+
+func TestSecure_Shuffle(t *testing.T) {
+	reader := &countingReader{r: cryptorand.Reader}
+	rng := New(&secureSource{reader: reader})
+	const size = 52
+	data := getSlice(size)
+	rng.Shuffle(size, func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+	if slices.Equal(data, getSlice(size)) {
+		t.Fatalf("deck was not shuffled")
+	}
+	slices.Sort(data)
+	if !slices.Equal(data, getSlice(size)) {
+		t.Fatalf("result is not a permutation")
+	}
+	// 51 indices fit in about nine words, all from a single block read.
+	if reader.reads != 1 {
+		t.Errorf("shuffling %d items took %d entropy reads, expected 1", size, reader.reads)
+	}
+}
+
+func TestSecure_Concurrent(t *testing.T) {
+	rng := NewSecure()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Go(func() {
+			for i := 0; i < 100; i++ {
+				data := getSlice(100)
+				rng.Shuffle(len(data), func(i, j int) {
+					data[i], data[j] = data[j], data[i]
+				})
+				slices.Sort(data)
+				if !slices.Equal(data, getSlice(100)) {
+					t.Errorf("concurrent shuffle is not a permutation")
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
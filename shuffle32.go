@@ -0,0 +1,88 @@
+package batchedrand
+
+import (
+	"math"
+	"math/bits"
+)
+
+// batchSize32 returns the number of indices Shuffle32 draws per 32-bit
+// random word when n elements remain. The levels are derived as for 64-bit
+// words, so that rejections remain rare.
+func batchSize32(n uint32) int {
+	return levelBatchSize(batchLevels32, uint64(n))
+}
+
+// wordHalves splits the 64-bit words of a source into 32-bit words, the
+// high half first.
+type wordHalves struct {
+	src uint64Source
+	// spare holds the unused low half of the last 64-bit word, if any.
+	spare     uint32
+	haveSpare bool
+}
+
+// Uint32 returns the next 32-bit word.
+func (h *wordHalves) Uint32() uint32 {
+	if h.haveSpare {
+		h.haveSpare = false
+		return h.spare
+	}
+	w := h.src.Uint64()
+	h.spare, h.haveSpare = uint32(w), true
+	return uint32(w >> 32)
+}
+
+// Shuffle32 pseudo-randomizes the order of elements like Shuffle, but with
+// 32-bit random words and 32-bit arithmetic (bits.Mul32), splitting each
+// 64-bit word of the source in two. It is meant for 32-bit platforms, where
+// bits.Mul64 is emulated: there, BenchmarkShuffle32 shows it faster than
+// Shuffle for small n, while for large n Shuffle, which still fits two
+// indices in each 64-bit word, remains faster.
+// n is the number of elements. Shuffle32 panics if n < 0 or n >= 2^32.
+// swap swaps the elements with indexes i and j.
+func (r *Rand) Shuffle32(n int, swap func(i, j int)) {
+	if n < 0 || uint64(n) > math.MaxUint32 {
+		panic("invalid argument to Shuffle32")
+	}
+	src, _ := r.shuffleSource()
+	h := wordHalves{src: src}
+	i := uint32(n)
+	// Single draws above the batch levels.
+	var indexes [maxBatch]uint32
+	for ; i > uint32(batchLevels32[0].max); i-- {
+		drawBatch32(&h, i, 1, i, &indexes)
+		swap(int(i-1), int(indexes[0]))
+	}
+	for _, level := range batchLevels32 {
+		if i > uint32(level.threshold) {
+			i = shuffleLevel32(&h, i, level, swap)
+		}
+	}
+}
+
+// rejected32 is rejected for 32-bit words.
+func rejected32(n uint32, k int, leftover uint32) bool {
+	product := uint32(1)
+	for j := 0; j < k; j++ {
+		product *= n - uint32(j)
+	}
+	return leftover < (-product)%product
+}
+
+// drawBatch32 is drawBatch for 32-bit words.
+func drawBatch32(r *wordHalves, n uint32, k int, bound uint32, dst *[maxBatch]uint32) {
+	leftover := batchIndices32(n, k, r.Uint32(), dst)
+	if leftover < bound {
+		for rejected32(n, k, leftover) {
+			leftover = batchIndices32(n, k, r.Uint32(), dst)
+		}
+	}
+}
+
+// batchIndices32 is batchIndices for 32-bit words.
+func batchIndices32(n uint32, k int, randVal uint32, dst *[maxBatch]uint32) uint32 {
+	for j := k - 1; j >= 0; j-- {
+		dst[j], randVal = bits.Mul32(n-uint32(j), randVal)
+	}
+	return randVal
+}
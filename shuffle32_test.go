@@ -0,0 +1,89 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestShuffle32_Permutation(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	for _, size := range []int{0, 1, 2, 7, 17, 100, 1000, 100000} {
+		data := getSlice(size)
+		rng.Shuffle32(size, func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+		slices.Sort(data)
+		if !slices.Equal(data, getSlice(size)) {
+			t.Fatalf("size %d: result is not a permutation", size)
+		}
+	}
+}
+
+func TestShuffle32_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	checkShuffleUniform(t, "Shuffle32", 4, 24*2000, func(data []int) {
+		rng.Shuffle32(len(data), func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+	})
+}
+
+func TestShuffle32_Positions(t *testing.T) {
+	// Every value reaches every position, across all batch sizes.
+	rng := New(rand.NewPCG(1, 2))
+	const size = 1000
+	seen := make([][]bool, size)
+	for i := range seen {
+		seen[i] = make([]bool, size)
+	}
+	for trial := 0; trial < 20000; trial++ {
+		data := getSlice(size)
+		rng.Shuffle32(size, func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+		for pos, v := range data {
+			seen[v][pos] = true
+		}
+	}
+	for v := range seen {
+		for pos, ok := range seen[v] {
+			if !ok {
+				t.Fatalf("value %d never reached position %d", v, pos)
+			}
+		}
+	}
+}
+
+func BenchmarkShuffle32(b *testing.B) {
+	for _, size := range []int{30, 100, 500000} {
+		b.Run(fmt.Sprintf("Batched_size_%d", size), func(b *testing.B) {
+			rng := New(rand.NewPCG(1, 2))
+			data := getSlice(size)
+			for i := 0; i < b.N; i++ {
+				rng.Shuffle(len(data), func(i, j int) {
+					data[i], data[j] = data[j], data[i]
+				})
+			}
+		})
+		b.Run(fmt.Sprintf("Batched32_size_%d", size), func(b *testing.B) {
+			rng := New(rand.NewPCG(1, 2))
+			data := getSlice(size)
+			for i := 0; i < b.N; i++ {
+				rng.Shuffle32(len(data), func(i, j int) {
+					data[i], data[j] = data[j], data[i]
+				})
+			}
+		})
+		b.Run(fmt.Sprintf("Standard_size_%d", size), func(b *testing.B) {
+			rng := rand.New(rand.NewPCG(1, 2))
+			data := getSlice(size)
+			for i := 0; i < b.N; i++ {
+				rng.Shuffle(len(data), func(i, j int) {
+					data[i], data[j] = data[j], data[i]
+				})
+			}
+		})
+	}
+}
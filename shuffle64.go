@@ -0,0 +1,29 @@
+package batchedrand
+
+// Shuffle64 pseudo-randomizes the order of n elements like Shuffle, but
+// with 64-bit indexes, so that even on 32-bit platforms it can address
+// virtual arrays (file records, sharded storage) of more than 2^31
+// elements. It draws the same words and performs the same swaps as Shuffle,
+// with the thresholds of r, but calls the Uint64 method of the source
+// through an interface.
+// swap swaps the elements with indexes i and j.
+func (r *Rand) Shuffle64(n uint64, swap func(i, j uint64)) {
+	src, levels := r.shuffleSource()
+	if n <= maxWordShuffle {
+		if n > 1 {
+			shuffleWord(src, int(n), swap)
+		}
+		return
+	}
+	n = shuffleAbove(src, n, levels[0].max, swap)
+	for _, level := range levels {
+		if n <= level.threshold {
+			continue
+		}
+		if n > dualStreamThreshold {
+			n = shuffleLevel64Dual(src, n, level, swap)
+		} else {
+			n = shuffleLevel64(src, n, level, swap)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package batchedrand
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestShuffle64_Permutation(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	for _, size := range []int{0, 1, 2, 7, 100, 1000, 100000} {
+		data := getSlice(size)
+		rng.Shuffle64(uint64(size), func(i, j uint64) {
+			data[i], data[j] = data[j], data[i]
+		})
+		slices.Sort(data)
+		if !slices.Equal(data, getSlice(size)) {
+			t.Fatalf("size %d: result is not a permutation", size)
+		}
+	}
+}
+
+func TestShuffle64_SameSwaps(t *testing.T) {
+	// Shuffle64 performs the swaps of Shuffle, with the thresholds of r.
+	type pair struct{ i, j uint64 }
+	for _, thresholds := range []Thresholds{nil, {{K: 3, Max: 1 << 21}, {K: 7, Max: 64}}} {
+		for _, size := range []int{0, 2, 20, 21, 100, 5000, dualStreamThreshold + 1001} {
+			var want, got []pair
+			rng := New(rand.NewPCG(1, 2))
+			if err := rng.SetThresholds(thresholds); err != nil {
+				t.Fatal(err)
+			}
+			rng.Shuffle(size, func(i, j int) {
+				want = append(want, pair{uint64(i), uint64(j)})
+			})
+			rng = New(rand.NewPCG(1, 2))
+			if err := rng.SetThresholds(thresholds); err != nil {
+				t.Fatal(err)
+			}
+			rng.Shuffle64(uint64(size), func(i, j uint64) {
+				got = append(got, pair{i, j})
+			})
+			if !slices.Equal(got, want) {
+				t.Errorf("%v, size %d: Shuffle64 swaps differ from those of Shuffle", thresholds, size)
+			}
+		}
+	}
+}
+
+func TestShuffle64_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	checkShuffleUniform(t, "Shuffle64", 4, 24*2000, func(data []int) {
+		rng.Shuffle64(uint64(len(data)), func(i, j uint64) {
+			data[i], data[j] = data[j], data[i]
+		})
+	})
+}
+
+// errEnough stops a shuffle of a virtual array early.
+type errEnough struct{}
+
+func TestShuffle64_Huge(t *testing.T) {
+	for _, n := range []uint64{1<<40 + 3, 1 << 35} {
+		testShuffle64Prefix(t, n)
+	}
+}
+
+// testShuffle64Prefix checks the first swaps of a shuffle of n elements.
+// Indexes beyond 2^32 must be addressable, even on 32-bit platforms.
+func testShuffle64Prefix(t *testing.T, n uint64) {
+	rng := New(rand.NewPCG(1, 2))
+	swaps := 0
+	large := false
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(errEnough); !ok {
+					panic(r)
+				}
+			}
+		}()
+		rng.Shuffle64(n, func(i, j uint64) {
+			if i != n-1-uint64(swaps) {
+				t.Fatalf("swap %d is at position %d, expected %d", swaps, i, n-1-uint64(swaps))
+			}
+			if j > i {
+				t.Fatalf("swap target %d above position %d", j, i)
+			}
+			if j >= 1<<32 {
+				large = true
+			}
+			swaps++
+			if swaps == 1000 {
+				panic(errEnough{})
+			}
+		})
+	}()
+	if swaps != 1000 {
+		t.Fatalf("saw %d swaps, expected 1000", swaps)
+	}
+	if !large {
+		t.Errorf("no swap target above 2^32 among 1000 swaps")
+	}
+}
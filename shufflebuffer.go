@@ -0,0 +1,128 @@
+package batchedrand
+
+import "iter"
+
+// ShuffleBuffer performs windowed (approximate) shuffling of a stream too
+// large to hold in memory: it keeps a fixed number of items and, once
+// full, every new item replaces a uniformly chosen buffered item, which is
+// emitted. This is the shuffle buffer of tf.data and similar pipelines. Larger
+// buffers give better mixing; a buffer at least as large as the stream
+// yields a uniform shuffle. Replacement indices are drawn in batches, as
+// in Shuffle.
+//
+// A ShuffleBuffer is not safe for concurrent use.
+type ShuffleBuffer[T any] struct {
+	r     *Rand
+	items []T
+	size  int
+	// pending[next:count] are buffered indices in [0, size).
+	pending     [MaxDistinct]uint64
+	next, count int
+}
+
+// NewShuffleBuffer returns an empty shuffle buffer holding up to size items.
+// It panics if size < 1.
+func NewShuffleBuffer[T any](r *Rand, size int) *ShuffleBuffer[T] {
+	if size < 1 {
+		panic("invalid argument to NewShuffleBuffer")
+	}
+	return &ShuffleBuffer[T]{r: r, items: make([]T, 0, size), size: size}
+}
+
+// Len returns the number of buffered items.
+func (b *ShuffleBuffer[T]) Len() int {
+	return len(b.items)
+}
+
+// Push adds x to the buffer. While the buffer is filling up, Push returns
+// the zero value and false. Once it is full, x replaces a uniformly chosen
+// buffered item, which Push returns along with true.
+func (b *ShuffleBuffer[T]) Push(x T) (T, bool) {
+	if len(b.items) < b.size {
+		b.items = append(b.items, x)
+		var zero T
+		return zero, false
+	}
+	if b.next == b.count {
+		k := batchSize(uint64(b.size))
+		b.r.batchedUniform(uint64(b.size), b.pending[:k])
+		b.next, b.count = 0, k
+	}
+	j := b.pending[b.next]
+	b.next++
+	out := b.items[j]
+	b.items[j] = x
+	return out, true
+}
+
+// Drain empties the buffer, yielding the remaining items in uniformly
+// random order.
+func (b *ShuffleBuffer[T]) Drain() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		var indexes [MaxDistinct]uint64
+		for len(b.items) > 0 {
+			n := len(b.items)
+			k := min(batchSize(uint64(n)), n)
+			b.r.batchedIndices(uint64(n), indexes[:k])
+			for _, j := range indexes[:k] {
+				last := len(b.items) - 1
+				b.items[j], b.items[last] = b.items[last], b.items[j]
+				x := b.items[last]
+				var zero T
+				b.items[last] = zero
+				b.items = b.items[:last]
+				if !yield(x) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ShuffleSeq returns a sequence yielding the items of seq in an order
+// shuffled through a ShuffleBuffer of the given size. No item moves more
+// than bufSize positions earlier, and the whole sequence is uniformly
+// shuffled when it has at most bufSize items. It panics if bufSize < 1.
+func ShuffleSeq[T any](r *Rand, seq iter.Seq[T], bufSize int) iter.Seq[T] {
+	if bufSize < 1 {
+		panic("invalid argument to ShuffleSeq")
+	}
+	return func(yield func(T) bool) {
+		b := NewShuffleBuffer[T](r, bufSize)
+		for x := range seq {
+			if out, ok := b.Push(x); ok && !yield(out) {
+				return
+			}
+		}
+		for x := range b.Drain() {
+			if !yield(x) {
+				return
+			}
+		}
+	}
+}
+
+// ShuffleChan returns a channel receiving the values sent on in, shuffled
+// through a ShuffleBuffer of the given size. The returned channel is closed
+// once in is closed and the buffer has been drained; a goroutine runs until
+// then, so the caller must keep receiving, and r must not be used
+// elsewhere in the meantime. It panics if bufSize < 1.
+func ShuffleChan[T any](r *Rand, in <-chan T, bufSize int) <-chan T {
+	if bufSize < 1 {
+		panic("invalid argument to ShuffleChan")
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		b := NewShuffleBuffer[T](r, bufSize)
+		for x := range in {
+			if y, ok := b.Push(x); ok {
+				out <- y
+			}
+		}
+		for x := range b.Drain() {
+			out <- x
+		}
+	}()
+	return out
+}
@@ -0,0 +1,149 @@
+package batchedrand
+
+import (
+	"iter"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestShuffleSeq_Contents(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	for _, size := range []int{0, 1, 10, 1000, 100000} {
+		for _, bufSize := range []int{1, 7, 1000, 5000} {
+			var got []int
+			for i, x := range enumerate(ShuffleSeq(rng, slices.Values(getSlice(size)), bufSize)) {
+				if x > i+bufSize {
+					t.Fatalf("size %d, buffer %d: item %d emitted at position %d", size, bufSize, x, i)
+				}
+				got = append(got, x)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, getSlice(size)) {
+				t.Fatalf("size %d, buffer %d: output is not a permutation", size, bufSize)
+			}
+		}
+	}
+}
+
+// enumerate pairs each value of seq with its position.
+func enumerate[T any](seq iter.Seq[T]) iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		i := 0
+		for x := range seq {
+			if !yield(i, x) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+func TestShuffleSeq_EarlyStop(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	n := 0
+	for range ShuffleSeq(rng, slices.Values(getSlice(100)), 10) {
+		n++
+		if n == 5 {
+			break
+		}
+	}
+	if n != 5 {
+		t.Fatalf("received %d items, expected 5", n)
+	}
+}
+
+func TestShuffleSeq_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	// A buffer as large as the stream gives a uniform shuffle.
+	counts := make(map[[4]int]int)
+	const numTrials = 24 * 4000
+	for trial := 0; trial < numTrials; trial++ {
+		var key [4]int
+		for i, x := range enumerate(ShuffleSeq(rng, slices.Values([]int{0, 1, 2, 3}), 4)) {
+			key[i] = x
+		}
+		counts[key]++
+	}
+	if len(counts) != 24 {
+		t.Fatalf("saw %d permutations, expected 24", len(counts))
+	}
+	for perm, c := range counts {
+		if c < 3600 || c > 4400 {
+			t.Errorf("permutation %v seen %d times, expected about 4000", perm, c)
+		}
+	}
+}
+
+func TestShuffleBuffer_EmitsEachItemOnce(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	b := NewShuffleBuffer[int](rng, 10)
+	for i := 0; i < 10; i++ {
+		if _, ok := b.Push(i); ok {
+			t.Fatalf("Push emitted an item before the buffer was full")
+		}
+	}
+	counts := make([]int, 10)
+	const numPushes = 100000
+	for i := 0; i < numPushes; i++ {
+		out, ok := b.Push(i + 10)
+		if !ok {
+			t.Fatalf("Push did not emit from a full buffer")
+		}
+		if out < 10 {
+			counts[out]++
+		}
+	}
+	// With this many pushes, each original item is all but certainly
+	// emitted, and never more than once.
+	for v, c := range counts {
+		if c != 1 {
+			t.Errorf("original item %d emitted %d times", v, c)
+		}
+	}
+	if b.Len() != 10 {
+		t.Errorf("Len is %d, expected 10", b.Len())
+	}
+}
+
+func TestShuffleBuffer_FirstOutputUniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{4, 5, 6}))
+	const bufSize = 5
+	counts := make([]int, bufSize)
+	const numTrials = bufSize * 10000
+	for trial := 0; trial < numTrials; trial++ {
+		b := NewShuffleBuffer[int](rng, bufSize)
+		for i := 0; i < bufSize; i++ {
+			b.Push(i)
+		}
+		out, _ := b.Push(bufSize)
+		counts[out]++
+	}
+	for v, c := range counts {
+		if c < 9000 || c > 11000 {
+			t.Errorf("item %d emitted first %d times, expected about 10000", v, c)
+		}
+	}
+}
+
+func TestShuffleChan(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	in := make(chan int)
+	go func() {
+		for i := 0; i < 10000; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+	var got []int
+	for x := range ShuffleChan(rng, in, 100) {
+		got = append(got, x)
+	}
+	if slices.Equal(got, getSlice(10000)) {
+		t.Fatalf("output was not shuffled")
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, getSlice(10000)) {
+		t.Fatalf("output is not a permutation of the input")
+	}
+}
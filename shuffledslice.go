@@ -0,0 +1,61 @@
+package batchedrand
+
+// ShuffledSlice accumulates items so that, at any moment, its contents are
+// a uniformly random permutation of everything appended so far. Each Append
+// places the new item at a uniformly random position (the "inside-out"
+// Fisher-Yates shuffle), and several positions are derived from each
+// random word, as in Shuffle.
+//
+// A ShuffledSlice is not safe for concurrent use.
+type ShuffledSlice[T any] struct {
+	r     *Rand
+	items []T
+	// pending[:count] are buffered positions for the next appends: the
+	// m-th next append uses pending[count-1-m], uniform in [0, len(items)+m].
+	pending [MaxDistinct]uint64
+	count   int
+}
+
+// NewShuffledSlice returns an empty ShuffledSlice drawing from r.
+func NewShuffledSlice[T any](r *Rand) *ShuffledSlice[T] {
+	return &ShuffledSlice[T]{r: r}
+}
+
+// Append inserts x at a uniformly random position.
+func (s *ShuffledSlice[T]) Append(x T) {
+	i := len(s.items)
+	if s.count == 0 {
+		k := batchSize(uint64(i + MaxDistinct))
+		s.r.batchedIndices(uint64(i+k), s.pending[:k])
+		s.count = k
+	}
+	s.count--
+	j := s.pending[s.count]
+	s.items = append(s.items, x)
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+}
+
+// AppendAll inserts each of xs at a uniformly random position.
+func (s *ShuffledSlice[T]) AppendAll(xs ...T) {
+	for _, x := range xs {
+		s.Append(x)
+	}
+}
+
+// Len returns the number of items appended since creation or the last Clear.
+func (s *ShuffledSlice[T]) Len() int {
+	return len(s.items)
+}
+
+// Snapshot returns a copy of the current contents, a uniformly random
+// permutation of the items appended so far.
+func (s *ShuffledSlice[T]) Snapshot() []T {
+	return append([]T(nil), s.items...)
+}
+
+// Clear removes all items, retaining the allocated storage.
+func (s *ShuffledSlice[T]) Clear() {
+	clear(s.items)
+	s.items = s.items[:0]
+	s.count = 0
+}
@@ -0,0 +1,61 @@
+package batchedrand
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestShuffledSlice_Contents(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	s := NewShuffledSlice[int](rng)
+	for i := 0; i < 5000; i++ {
+		s.Append(i)
+		if i%997 == 0 {
+			got := s.Snapshot()
+			slices.Sort(got)
+			if !slices.Equal(got, getSlice(i+1)) {
+				t.Fatalf("after %d appends, snapshot is not a permutation", i+1)
+			}
+		}
+	}
+	s.Clear()
+	if s.Len() != 0 {
+		t.Fatalf("Len is %d after Clear", s.Len())
+	}
+	s.AppendAll(1, 2, 3)
+	if s.Len() != 3 {
+		t.Fatalf("Len is %d after AppendAll of 3 items", s.Len())
+	}
+}
+
+func TestShuffledSlice_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	// Check every intermediate snapshot size, since the buffered positions
+	// straddle them.
+	for size := 1; size <= 5; size++ {
+		s := NewShuffledSlice[int](rng)
+		numTrials := 4000
+		for f := 2; f <= size; f++ {
+			numTrials *= f
+		}
+		counts := make(map[[5]int]int)
+		for trial := 0; trial < numTrials; trial++ {
+			s.Clear()
+			for i := 0; i < size; i++ {
+				s.Append(i)
+			}
+			var key [5]int
+			copy(key[:], s.Snapshot())
+			counts[key]++
+		}
+		if len(counts) != numTrials/4000 {
+			t.Fatalf("size %d: saw %d permutations, expected %d", size, len(counts), numTrials/4000)
+		}
+		for perm, c := range counts {
+			if c < 3600 || c > 4400 {
+				t.Errorf("size %d: permutation %v seen %d times, expected about 4000", size, perm, c)
+			}
+		}
+	}
+}
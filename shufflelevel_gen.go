@@ -0,0 +1,1052 @@
+// Code generated by internal/gen; DO NOT EDIT.
+
+package batchedrand
+
+import (
+	"math/bits"
+	"math/rand/v2"
+)
+
+// shuffleLevel performs the swaps of the batched algorithm from i
+// remaining elements down to the threshold of level, and returns the new
+// number of remaining elements. At the last level, the i-1 remaining
+// indices are drawn in a single batch. Batches of 2 to 6, those of all
+// but small shuffles, are unrolled; only their rare slow path goes through
+// drawBatch.
+func shuffleLevel[S uint64Source](r S, i uint64, level batchLevel, swap func(i, j int)) uint64 {
+	bound := level.bound
+	// The unrolled loops stop before a batch could exceed i-1 indices.
+	stop := max(level.threshold, uint64(level.k))
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 2 {
+			word := r.Uint64()
+			index1, lo := bits.Mul64(i-1, word)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 2, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				index0, index1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 3:
+		for ; i > stop; i -= 3 {
+			word := r.Uint64()
+			index2, lo := bits.Mul64(i-2, word)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 3, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 3, bound, &indexes)
+				index0, index1, index2 = indexes[0], indexes[1], indexes[2]
+			}
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 4:
+		for ; i > stop; i -= 4 {
+			word := r.Uint64()
+			index3, lo := bits.Mul64(i-3, word)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 4, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 4, bound, &indexes)
+				index0, index1, index2, index3 = indexes[0], indexes[1], indexes[2], indexes[3]
+			}
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 5:
+		for ; i > stop; i -= 5 {
+			word := r.Uint64()
+			index4, lo := bits.Mul64(i-4, word)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 5, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 5, bound, &indexes)
+				index0, index1, index2, index3, index4 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4]
+			}
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 6:
+		for ; i > stop; i -= 6 {
+			word := r.Uint64()
+			index5, lo := bits.Mul64(i-5, word)
+			index4, lo := bits.Mul64(i-4, lo)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 6, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 6, bound, &indexes)
+				index0, index1, index2, index3, index4, index5 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4], indexes[5]
+			}
+			swap(int(i-6), int(index5))
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	}
+	// Any batch size, and the final batch.
+	var indexes [maxBatch]uint64
+	for i > level.threshold {
+		k := min(level.k, int(i-1))
+		batch := indexes[:k]
+		word := r.Uint64()
+		randVal := word
+		for j := len(batch) - 1; j >= 0; j-- {
+			batch[j], randVal = bits.Mul64(i-uint64(j), randVal)
+		}
+		if randVal < bound && rejected(i, k, randVal) {
+			drawBatch(r, i, k, bound, &indexes)
+		}
+		for j := len(batch) - 1; j >= 0; j-- {
+			swap(int(i-1-uint64(j)), int(batch[j]))
+		}
+		i -= uint64(k)
+	}
+	return i
+}
+
+// shuffleLevelDual is shuffleLevel with two batches in flight: the chain of
+// multiplications of a batch is sequential, but those of two consecutive
+// batches are independent, so the processor can interleave their
+// multiplications and memory accesses. Only batches of 2, used above 2^19
+// elements, have two streams; other batch sizes, and the last batches, are
+// left to shuffleLevel.
+//
+// The two batches are drawn from consecutive words of the source, the
+// first for the upper batch; rejections are then resolved for the upper
+// batch, and then for the lower one. Barring rejections, the words are
+// thus used exactly as by shuffleLevel, and so are the swaps. Each batch
+// depends only on its own words, so both remain exactly uniform.
+func shuffleLevelDual[S uint64Source](r S, i uint64, level batchLevel, swap func(i, j int)) uint64 {
+	bound := level.bound
+	// Both batches must fit above the stop of shuffleLevel.
+	stop := max(level.threshold, uint64(level.k)) + uint64(level.k)
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 4 {
+			wordA := r.Uint64()
+			wordB := r.Uint64()
+			a1, loA := bits.Mul64(i-1, wordA)
+			b1, loB := bits.Mul64(i-3, wordB)
+			a0, loA := bits.Mul64(i, loA)
+			b0, loB := bits.Mul64(i-2, loB)
+			if loA < bound && rejected(i, 2, loA) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				a0, a1 = indexes[0], indexes[1]
+			}
+			if loB < bound && rejected(i-2, 2, loB) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i-2, 2, bound, &indexes)
+				b0, b1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(a1))
+			swap(int(i-1), int(a0))
+			swap(int(i-4), int(b1))
+			swap(int(i-3), int(b0))
+		}
+	}
+	return shuffleLevel(r, i, level, swap)
+}
+
+// shuffleLevelPCG is shuffleLevel for a *rand.PCG source, whose Uint64
+// method it calls directly rather than through an interface.
+func shuffleLevelPCG(r *rand.PCG, i uint64, level batchLevel, swap func(i, j int)) uint64 {
+	bound := level.bound
+	// The unrolled loops stop before a batch could exceed i-1 indices.
+	stop := max(level.threshold, uint64(level.k))
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 2 {
+			word := r.Uint64()
+			index1, lo := bits.Mul64(i-1, word)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 2, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				index0, index1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 3:
+		for ; i > stop; i -= 3 {
+			word := r.Uint64()
+			index2, lo := bits.Mul64(i-2, word)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 3, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 3, bound, &indexes)
+				index0, index1, index2 = indexes[0], indexes[1], indexes[2]
+			}
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 4:
+		for ; i > stop; i -= 4 {
+			word := r.Uint64()
+			index3, lo := bits.Mul64(i-3, word)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 4, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 4, bound, &indexes)
+				index0, index1, index2, index3 = indexes[0], indexes[1], indexes[2], indexes[3]
+			}
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 5:
+		for ; i > stop; i -= 5 {
+			word := r.Uint64()
+			index4, lo := bits.Mul64(i-4, word)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 5, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 5, bound, &indexes)
+				index0, index1, index2, index3, index4 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4]
+			}
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 6:
+		for ; i > stop; i -= 6 {
+			word := r.Uint64()
+			index5, lo := bits.Mul64(i-5, word)
+			index4, lo := bits.Mul64(i-4, lo)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 6, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 6, bound, &indexes)
+				index0, index1, index2, index3, index4, index5 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4], indexes[5]
+			}
+			swap(int(i-6), int(index5))
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	}
+	// Any batch size, and the final batch.
+	var indexes [maxBatch]uint64
+	for i > level.threshold {
+		k := min(level.k, int(i-1))
+		batch := indexes[:k]
+		word := r.Uint64()
+		randVal := word
+		for j := len(batch) - 1; j >= 0; j-- {
+			batch[j], randVal = bits.Mul64(i-uint64(j), randVal)
+		}
+		if randVal < bound && rejected(i, k, randVal) {
+			drawBatch(r, i, k, bound, &indexes)
+		}
+		for j := len(batch) - 1; j >= 0; j-- {
+			swap(int(i-1-uint64(j)), int(batch[j]))
+		}
+		i -= uint64(k)
+	}
+	return i
+}
+
+// shuffleLevelPCGDual is shuffleLevelDual for a *rand.PCG source.
+func shuffleLevelPCGDual(r *rand.PCG, i uint64, level batchLevel, swap func(i, j int)) uint64 {
+	bound := level.bound
+	// Both batches must fit above the stop of shuffleLevelPCG.
+	stop := max(level.threshold, uint64(level.k)) + uint64(level.k)
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 4 {
+			wordA := r.Uint64()
+			wordB := r.Uint64()
+			a1, loA := bits.Mul64(i-1, wordA)
+			b1, loB := bits.Mul64(i-3, wordB)
+			a0, loA := bits.Mul64(i, loA)
+			b0, loB := bits.Mul64(i-2, loB)
+			if loA < bound && rejected(i, 2, loA) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				a0, a1 = indexes[0], indexes[1]
+			}
+			if loB < bound && rejected(i-2, 2, loB) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i-2, 2, bound, &indexes)
+				b0, b1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(a1))
+			swap(int(i-1), int(a0))
+			swap(int(i-4), int(b1))
+			swap(int(i-3), int(b0))
+		}
+	}
+	return shuffleLevelPCG(r, i, level, swap)
+}
+
+// shuffleLevelChaCha8 is shuffleLevel for a *rand.ChaCha8 source, whose
+// Uint64 method it calls directly rather than through an interface.
+func shuffleLevelChaCha8(r *rand.ChaCha8, i uint64, level batchLevel, swap func(i, j int)) uint64 {
+	bound := level.bound
+	// The unrolled loops stop before a batch could exceed i-1 indices.
+	stop := max(level.threshold, uint64(level.k))
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 2 {
+			word := r.Uint64()
+			index1, lo := bits.Mul64(i-1, word)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 2, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				index0, index1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 3:
+		for ; i > stop; i -= 3 {
+			word := r.Uint64()
+			index2, lo := bits.Mul64(i-2, word)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 3, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 3, bound, &indexes)
+				index0, index1, index2 = indexes[0], indexes[1], indexes[2]
+			}
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 4:
+		for ; i > stop; i -= 4 {
+			word := r.Uint64()
+			index3, lo := bits.Mul64(i-3, word)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 4, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 4, bound, &indexes)
+				index0, index1, index2, index3 = indexes[0], indexes[1], indexes[2], indexes[3]
+			}
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 5:
+		for ; i > stop; i -= 5 {
+			word := r.Uint64()
+			index4, lo := bits.Mul64(i-4, word)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 5, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 5, bound, &indexes)
+				index0, index1, index2, index3, index4 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4]
+			}
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 6:
+		for ; i > stop; i -= 6 {
+			word := r.Uint64()
+			index5, lo := bits.Mul64(i-5, word)
+			index4, lo := bits.Mul64(i-4, lo)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 6, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 6, bound, &indexes)
+				index0, index1, index2, index3, index4, index5 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4], indexes[5]
+			}
+			swap(int(i-6), int(index5))
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	}
+	// Any batch size, and the final batch.
+	var indexes [maxBatch]uint64
+	for i > level.threshold {
+		k := min(level.k, int(i-1))
+		batch := indexes[:k]
+		word := r.Uint64()
+		randVal := word
+		for j := len(batch) - 1; j >= 0; j-- {
+			batch[j], randVal = bits.Mul64(i-uint64(j), randVal)
+		}
+		if randVal < bound && rejected(i, k, randVal) {
+			drawBatch(r, i, k, bound, &indexes)
+		}
+		for j := len(batch) - 1; j >= 0; j-- {
+			swap(int(i-1-uint64(j)), int(batch[j]))
+		}
+		i -= uint64(k)
+	}
+	return i
+}
+
+// shuffleLevelChaCha8Dual is shuffleLevelDual for a *rand.ChaCha8 source.
+func shuffleLevelChaCha8Dual(r *rand.ChaCha8, i uint64, level batchLevel, swap func(i, j int)) uint64 {
+	bound := level.bound
+	// Both batches must fit above the stop of shuffleLevelChaCha8.
+	stop := max(level.threshold, uint64(level.k)) + uint64(level.k)
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 4 {
+			wordA := r.Uint64()
+			wordB := r.Uint64()
+			a1, loA := bits.Mul64(i-1, wordA)
+			b1, loB := bits.Mul64(i-3, wordB)
+			a0, loA := bits.Mul64(i, loA)
+			b0, loB := bits.Mul64(i-2, loB)
+			if loA < bound && rejected(i, 2, loA) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				a0, a1 = indexes[0], indexes[1]
+			}
+			if loB < bound && rejected(i-2, 2, loB) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i-2, 2, bound, &indexes)
+				b0, b1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(a1))
+			swap(int(i-1), int(a0))
+			swap(int(i-4), int(b1))
+			swap(int(i-3), int(b0))
+		}
+	}
+	return shuffleLevelChaCha8(r, i, level, swap)
+}
+
+// shuffleLevelBuffered is shuffleLevel for a Buffered source: it reads
+// the words straight from the buffer, refilling it when it is empty,
+// rather than calling Uint64 for each word.
+func shuffleLevelBuffered(r *Buffered, i uint64, level batchLevel, swap func(i, j int)) uint64 {
+	bound := level.bound
+	// The unrolled loops stop before a batch could exceed i-1 indices.
+	stop := max(level.threshold, uint64(level.k))
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 2 {
+			if r.pos == bufferedWords {
+				r.refill()
+			}
+			word := r.buf[r.pos]
+			r.pos++
+			index1, lo := bits.Mul64(i-1, word)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 2, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				index0, index1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 3:
+		for ; i > stop; i -= 3 {
+			if r.pos == bufferedWords {
+				r.refill()
+			}
+			word := r.buf[r.pos]
+			r.pos++
+			index2, lo := bits.Mul64(i-2, word)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 3, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 3, bound, &indexes)
+				index0, index1, index2 = indexes[0], indexes[1], indexes[2]
+			}
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 4:
+		for ; i > stop; i -= 4 {
+			if r.pos == bufferedWords {
+				r.refill()
+			}
+			word := r.buf[r.pos]
+			r.pos++
+			index3, lo := bits.Mul64(i-3, word)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 4, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 4, bound, &indexes)
+				index0, index1, index2, index3 = indexes[0], indexes[1], indexes[2], indexes[3]
+			}
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 5:
+		for ; i > stop; i -= 5 {
+			if r.pos == bufferedWords {
+				r.refill()
+			}
+			word := r.buf[r.pos]
+			r.pos++
+			index4, lo := bits.Mul64(i-4, word)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 5, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 5, bound, &indexes)
+				index0, index1, index2, index3, index4 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4]
+			}
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 6:
+		for ; i > stop; i -= 6 {
+			if r.pos == bufferedWords {
+				r.refill()
+			}
+			word := r.buf[r.pos]
+			r.pos++
+			index5, lo := bits.Mul64(i-5, word)
+			index4, lo := bits.Mul64(i-4, lo)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 6, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 6, bound, &indexes)
+				index0, index1, index2, index3, index4, index5 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4], indexes[5]
+			}
+			swap(int(i-6), int(index5))
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	}
+	// Any batch size, and the final batch.
+	var indexes [maxBatch]uint64
+	for i > level.threshold {
+		k := min(level.k, int(i-1))
+		batch := indexes[:k]
+		if r.pos == bufferedWords {
+			r.refill()
+		}
+		word := r.buf[r.pos]
+		r.pos++
+		randVal := word
+		for j := len(batch) - 1; j >= 0; j-- {
+			batch[j], randVal = bits.Mul64(i-uint64(j), randVal)
+		}
+		if randVal < bound && rejected(i, k, randVal) {
+			drawBatch(r, i, k, bound, &indexes)
+		}
+		for j := len(batch) - 1; j >= 0; j-- {
+			swap(int(i-1-uint64(j)), int(batch[j]))
+		}
+		i -= uint64(k)
+	}
+	return i
+}
+
+// shuffleLevelBufferedDual is shuffleLevelDual for a Buffered source.
+func shuffleLevelBufferedDual(r *Buffered, i uint64, level batchLevel, swap func(i, j int)) uint64 {
+	bound := level.bound
+	// Both batches must fit above the stop of shuffleLevelBuffered.
+	stop := max(level.threshold, uint64(level.k)) + uint64(level.k)
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 4 {
+			if r.pos == bufferedWords {
+				r.refill()
+			}
+			wordA := r.buf[r.pos]
+			r.pos++
+			if r.pos == bufferedWords {
+				r.refill()
+			}
+			wordB := r.buf[r.pos]
+			r.pos++
+			a1, loA := bits.Mul64(i-1, wordA)
+			b1, loB := bits.Mul64(i-3, wordB)
+			a0, loA := bits.Mul64(i, loA)
+			b0, loB := bits.Mul64(i-2, loB)
+			if loA < bound && rejected(i, 2, loA) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				a0, a1 = indexes[0], indexes[1]
+			}
+			if loB < bound && rejected(i-2, 2, loB) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i-2, 2, bound, &indexes)
+				b0, b1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(a1))
+			swap(int(i-1), int(a0))
+			swap(int(i-4), int(b1))
+			swap(int(i-3), int(b0))
+		}
+	}
+	return shuffleLevelBuffered(r, i, level, swap)
+}
+
+// shuffleLevelSlice is shuffleLevel for the elements of s, which it
+// swaps directly rather than through a callback.
+func shuffleLevelSlice[S uint64Source, T any](r S, i uint64, level batchLevel, s []T) uint64 {
+	bound := level.bound
+	// The unrolled loops stop before a batch could exceed i-1 indices.
+	stop := max(level.threshold, uint64(level.k))
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 2 {
+			word := r.Uint64()
+			index1, lo := bits.Mul64(i-1, word)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 2, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				index0, index1 = indexes[0], indexes[1]
+			}
+			s[i-2], s[index1] = s[index1], s[i-2]
+			s[i-1], s[index0] = s[index0], s[i-1]
+		}
+	case 3:
+		for ; i > stop; i -= 3 {
+			word := r.Uint64()
+			index2, lo := bits.Mul64(i-2, word)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 3, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 3, bound, &indexes)
+				index0, index1, index2 = indexes[0], indexes[1], indexes[2]
+			}
+			s[i-3], s[index2] = s[index2], s[i-3]
+			s[i-2], s[index1] = s[index1], s[i-2]
+			s[i-1], s[index0] = s[index0], s[i-1]
+		}
+	case 4:
+		for ; i > stop; i -= 4 {
+			word := r.Uint64()
+			index3, lo := bits.Mul64(i-3, word)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 4, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 4, bound, &indexes)
+				index0, index1, index2, index3 = indexes[0], indexes[1], indexes[2], indexes[3]
+			}
+			s[i-4], s[index3] = s[index3], s[i-4]
+			s[i-3], s[index2] = s[index2], s[i-3]
+			s[i-2], s[index1] = s[index1], s[i-2]
+			s[i-1], s[index0] = s[index0], s[i-1]
+		}
+	case 5:
+		for ; i > stop; i -= 5 {
+			word := r.Uint64()
+			index4, lo := bits.Mul64(i-4, word)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 5, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 5, bound, &indexes)
+				index0, index1, index2, index3, index4 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4]
+			}
+			s[i-5], s[index4] = s[index4], s[i-5]
+			s[i-4], s[index3] = s[index3], s[i-4]
+			s[i-3], s[index2] = s[index2], s[i-3]
+			s[i-2], s[index1] = s[index1], s[i-2]
+			s[i-1], s[index0] = s[index0], s[i-1]
+		}
+	case 6:
+		for ; i > stop; i -= 6 {
+			word := r.Uint64()
+			index5, lo := bits.Mul64(i-5, word)
+			index4, lo := bits.Mul64(i-4, lo)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 6, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 6, bound, &indexes)
+				index0, index1, index2, index3, index4, index5 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4], indexes[5]
+			}
+			s[i-6], s[index5] = s[index5], s[i-6]
+			s[i-5], s[index4] = s[index4], s[i-5]
+			s[i-4], s[index3] = s[index3], s[i-4]
+			s[i-3], s[index2] = s[index2], s[i-3]
+			s[i-2], s[index1] = s[index1], s[i-2]
+			s[i-1], s[index0] = s[index0], s[i-1]
+		}
+	}
+	// Any batch size, and the final batch.
+	var indexes [maxBatch]uint64
+	for i > level.threshold {
+		k := min(level.k, int(i-1))
+		batch := indexes[:k]
+		word := r.Uint64()
+		randVal := word
+		for j := len(batch) - 1; j >= 0; j-- {
+			batch[j], randVal = bits.Mul64(i-uint64(j), randVal)
+		}
+		if randVal < bound && rejected(i, k, randVal) {
+			drawBatch(r, i, k, bound, &indexes)
+		}
+		for j := len(batch) - 1; j >= 0; j-- {
+			s[i-1-uint64(j)], s[batch[j]] = s[batch[j]], s[i-1-uint64(j)]
+		}
+		i -= uint64(k)
+	}
+	return i
+}
+
+// shuffleLevelSliceDual is shuffleLevelDual for the elements of s.
+func shuffleLevelSliceDual[S uint64Source, T any](r S, i uint64, level batchLevel, s []T) uint64 {
+	bound := level.bound
+	// Both batches must fit above the stop of shuffleLevelSlice.
+	stop := max(level.threshold, uint64(level.k)) + uint64(level.k)
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 4 {
+			wordA := r.Uint64()
+			wordB := r.Uint64()
+			a1, loA := bits.Mul64(i-1, wordA)
+			b1, loB := bits.Mul64(i-3, wordB)
+			a0, loA := bits.Mul64(i, loA)
+			b0, loB := bits.Mul64(i-2, loB)
+			if loA < bound && rejected(i, 2, loA) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				a0, a1 = indexes[0], indexes[1]
+			}
+			if loB < bound && rejected(i-2, 2, loB) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i-2, 2, bound, &indexes)
+				b0, b1 = indexes[0], indexes[1]
+			}
+			s[i-2], s[a1] = s[a1], s[i-2]
+			s[i-1], s[a0] = s[a0], s[i-1]
+			s[i-4], s[b1] = s[b1], s[i-4]
+			s[i-3], s[b0] = s[b0], s[i-3]
+		}
+	}
+	return shuffleLevelSlice(r, i, level, s)
+}
+
+// shuffleLevel64 is shuffleLevel for Shuffle64, whose swap callback
+// takes 64-bit indexes.
+func shuffleLevel64[S uint64Source](r S, i uint64, level batchLevel, swap func(i, j uint64)) uint64 {
+	bound := level.bound
+	// The unrolled loops stop before a batch could exceed i-1 indices.
+	stop := max(level.threshold, uint64(level.k))
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 2 {
+			word := r.Uint64()
+			index1, lo := bits.Mul64(i-1, word)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 2, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				index0, index1 = indexes[0], indexes[1]
+			}
+			swap(i-2, index1)
+			swap(i-1, index0)
+		}
+	case 3:
+		for ; i > stop; i -= 3 {
+			word := r.Uint64()
+			index2, lo := bits.Mul64(i-2, word)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 3, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 3, bound, &indexes)
+				index0, index1, index2 = indexes[0], indexes[1], indexes[2]
+			}
+			swap(i-3, index2)
+			swap(i-2, index1)
+			swap(i-1, index0)
+		}
+	case 4:
+		for ; i > stop; i -= 4 {
+			word := r.Uint64()
+			index3, lo := bits.Mul64(i-3, word)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 4, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 4, bound, &indexes)
+				index0, index1, index2, index3 = indexes[0], indexes[1], indexes[2], indexes[3]
+			}
+			swap(i-4, index3)
+			swap(i-3, index2)
+			swap(i-2, index1)
+			swap(i-1, index0)
+		}
+	case 5:
+		for ; i > stop; i -= 5 {
+			word := r.Uint64()
+			index4, lo := bits.Mul64(i-4, word)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 5, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 5, bound, &indexes)
+				index0, index1, index2, index3, index4 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4]
+			}
+			swap(i-5, index4)
+			swap(i-4, index3)
+			swap(i-3, index2)
+			swap(i-2, index1)
+			swap(i-1, index0)
+		}
+	case 6:
+		for ; i > stop; i -= 6 {
+			word := r.Uint64()
+			index5, lo := bits.Mul64(i-5, word)
+			index4, lo := bits.Mul64(i-4, lo)
+			index3, lo := bits.Mul64(i-3, lo)
+			index2, lo := bits.Mul64(i-2, lo)
+			index1, lo := bits.Mul64(i-1, lo)
+			index0, lo := bits.Mul64(i, lo)
+			if lo < bound && rejected(i, 6, lo) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 6, bound, &indexes)
+				index0, index1, index2, index3, index4, index5 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4], indexes[5]
+			}
+			swap(i-6, index5)
+			swap(i-5, index4)
+			swap(i-4, index3)
+			swap(i-3, index2)
+			swap(i-2, index1)
+			swap(i-1, index0)
+		}
+	}
+	// Any batch size, and the final batch.
+	var indexes [maxBatch]uint64
+	for i > level.threshold {
+		k := min(level.k, int(i-1))
+		batch := indexes[:k]
+		word := r.Uint64()
+		randVal := word
+		for j := len(batch) - 1; j >= 0; j-- {
+			batch[j], randVal = bits.Mul64(i-uint64(j), randVal)
+		}
+		if randVal < bound && rejected(i, k, randVal) {
+			drawBatch(r, i, k, bound, &indexes)
+		}
+		for j := len(batch) - 1; j >= 0; j-- {
+			swap(i-1-uint64(j), batch[j])
+		}
+		i -= uint64(k)
+	}
+	return i
+}
+
+// shuffleLevel64Dual is shuffleLevelDual for Shuffle64.
+func shuffleLevel64Dual[S uint64Source](r S, i uint64, level batchLevel, swap func(i, j uint64)) uint64 {
+	bound := level.bound
+	// Both batches must fit above the stop of shuffleLevel64.
+	stop := max(level.threshold, uint64(level.k)) + uint64(level.k)
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 4 {
+			wordA := r.Uint64()
+			wordB := r.Uint64()
+			a1, loA := bits.Mul64(i-1, wordA)
+			b1, loB := bits.Mul64(i-3, wordB)
+			a0, loA := bits.Mul64(i, loA)
+			b0, loB := bits.Mul64(i-2, loB)
+			if loA < bound && rejected(i, 2, loA) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i, 2, bound, &indexes)
+				a0, a1 = indexes[0], indexes[1]
+			}
+			if loB < bound && rejected(i-2, 2, loB) {
+				var indexes [maxBatch]uint64
+				drawBatch(r, i-2, 2, bound, &indexes)
+				b0, b1 = indexes[0], indexes[1]
+			}
+			swap(i-2, a1)
+			swap(i-1, a0)
+			swap(i-4, b1)
+			swap(i-3, b0)
+		}
+	}
+	return shuffleLevel64(r, i, level, swap)
+}
+
+// shuffleLevel32 is shuffleLevel for Shuffle32, with 32-bit words and
+// arithmetic.
+func shuffleLevel32(r *wordHalves, i uint32, level batchLevel, swap func(i, j int)) uint32 {
+	bound := uint32(level.bound)
+	// The unrolled loops stop before a batch could exceed i-1 indices.
+	stop := max(uint32(level.threshold), uint32(level.k))
+	switch level.k {
+	case 2:
+		for ; i > stop; i -= 2 {
+			word := r.Uint32()
+			index1, lo := bits.Mul32(i-1, word)
+			index0, lo := bits.Mul32(i, lo)
+			if lo < bound && rejected32(i, 2, lo) {
+				var indexes [maxBatch]uint32
+				drawBatch32(r, i, 2, bound, &indexes)
+				index0, index1 = indexes[0], indexes[1]
+			}
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 3:
+		for ; i > stop; i -= 3 {
+			word := r.Uint32()
+			index2, lo := bits.Mul32(i-2, word)
+			index1, lo := bits.Mul32(i-1, lo)
+			index0, lo := bits.Mul32(i, lo)
+			if lo < bound && rejected32(i, 3, lo) {
+				var indexes [maxBatch]uint32
+				drawBatch32(r, i, 3, bound, &indexes)
+				index0, index1, index2 = indexes[0], indexes[1], indexes[2]
+			}
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 4:
+		for ; i > stop; i -= 4 {
+			word := r.Uint32()
+			index3, lo := bits.Mul32(i-3, word)
+			index2, lo := bits.Mul32(i-2, lo)
+			index1, lo := bits.Mul32(i-1, lo)
+			index0, lo := bits.Mul32(i, lo)
+			if lo < bound && rejected32(i, 4, lo) {
+				var indexes [maxBatch]uint32
+				drawBatch32(r, i, 4, bound, &indexes)
+				index0, index1, index2, index3 = indexes[0], indexes[1], indexes[2], indexes[3]
+			}
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 5:
+		for ; i > stop; i -= 5 {
+			word := r.Uint32()
+			index4, lo := bits.Mul32(i-4, word)
+			index3, lo := bits.Mul32(i-3, lo)
+			index2, lo := bits.Mul32(i-2, lo)
+			index1, lo := bits.Mul32(i-1, lo)
+			index0, lo := bits.Mul32(i, lo)
+			if lo < bound && rejected32(i, 5, lo) {
+				var indexes [maxBatch]uint32
+				drawBatch32(r, i, 5, bound, &indexes)
+				index0, index1, index2, index3, index4 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4]
+			}
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	case 6:
+		for ; i > stop; i -= 6 {
+			word := r.Uint32()
+			index5, lo := bits.Mul32(i-5, word)
+			index4, lo := bits.Mul32(i-4, lo)
+			index3, lo := bits.Mul32(i-3, lo)
+			index2, lo := bits.Mul32(i-2, lo)
+			index1, lo := bits.Mul32(i-1, lo)
+			index0, lo := bits.Mul32(i, lo)
+			if lo < bound && rejected32(i, 6, lo) {
+				var indexes [maxBatch]uint32
+				drawBatch32(r, i, 6, bound, &indexes)
+				index0, index1, index2, index3, index4, index5 = indexes[0], indexes[1], indexes[2], indexes[3], indexes[4], indexes[5]
+			}
+			swap(int(i-6), int(index5))
+			swap(int(i-5), int(index4))
+			swap(int(i-4), int(index3))
+			swap(int(i-3), int(index2))
+			swap(int(i-2), int(index1))
+			swap(int(i-1), int(index0))
+		}
+	}
+	// Any batch size, and the final batch.
+	var indexes [maxBatch]uint32
+	for i > uint32(level.threshold) {
+		k := min(level.k, int(i-1))
+		batch := indexes[:k]
+		word := r.Uint32()
+		randVal := word
+		for j := len(batch) - 1; j >= 0; j-- {
+			batch[j], randVal = bits.Mul32(i-uint32(j), randVal)
+		}
+		if randVal < bound && rejected32(i, k, randVal) {
+			drawBatch32(r, i, k, bound, &indexes)
+		}
+		for j := len(batch) - 1; j >= 0; j-- {
+			swap(int(i-1-uint32(j)), int(batch[j]))
+		}
+		i -= uint32(k)
+	}
+	return i
+}
@@ -0,0 +1,48 @@
+package batchedrand
+
+import "math/bits"
+
+// maxWordShuffle is the largest n such that n! < 2^64: up to n =
+// maxWordShuffle, a single random word encodes a whole permutation.
+const maxWordShuffle = 20
+
+// factorials[n] is n!, for n <= maxWordShuffle.
+var factorials = func() (f [maxWordShuffle + 1]uint64) {
+	f[0] = 1
+	for n := 1; n <= maxWordShuffle; n++ {
+		f[n] = f[n-1] * uint64(n)
+	}
+	return f
+}()
+
+// shuffleWord implements Shuffle for 2 <= n <= maxWordShuffle, drawing the
+// whole permutation from a single random word (plus rare rejections): the
+// batched multiply chain by 2, 3, ..., n gives an index in [0, m) for each
+// m <= n, all of them uniform and independent once the leftover passes the
+// exact check against n!. A rejection happens when the leftover is below
+// 2^64 mod n!, with probability (2^64 mod n!)/2^64 < n!/2^64: less than
+// 2^-20 for n <= 16, but 7.7% for n = 20. With PCG, BenchmarkWordShuffle
+// measured it 30 to 40% faster than batches of up to 6 for 5 to 16
+// elements, and 15% faster for 20 elements.
+func shuffleWord[S uint64Source, I swapIndex](r S, n int, swap func(i, j I)) {
+	var indexes [maxWordShuffle + 1]uint64
+	leftover := wordIndices(n, r.Uint64(), &indexes)
+	if f := factorials[n]; leftover < f {
+		t := (-f) % f
+		for leftover < t {
+			leftover = wordIndices(n, r.Uint64(), &indexes)
+		}
+	}
+	for m := n; m > 1; m-- {
+		swap(I(m-1), I(indexes[m]))
+	}
+}
+
+// wordIndices sets indexes[m] to the index in [0, m) given by the random
+// word randVal, for 2 <= m <= n, and returns the leftover.
+func wordIndices(n int, randVal uint64, indexes *[maxWordShuffle + 1]uint64) uint64 {
+	for m := 2; m <= n; m++ {
+		indexes[m], randVal = bits.Mul64(uint64(m), randVal)
+	}
+	return randVal
+}
@@ -0,0 +1,99 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestFactorials(t *testing.T) {
+	f := big.NewInt(1)
+	for n := 1; n <= maxWordShuffle; n++ {
+		f.Mul(f, big.NewInt(int64(n)))
+		if !f.IsUint64() || f.Uint64() != factorials[n] {
+			t.Fatalf("factorials[%d] = %d, expected %v", n, factorials[n], f)
+		}
+	}
+	// maxWordShuffle is the largest n with n! < 2^64.
+	if f.Mul(f, big.NewInt(maxWordShuffle+1)); f.IsUint64() {
+		t.Errorf("%d! = %v fits in 64 bits", maxWordShuffle+1, f)
+	}
+}
+
+func TestShuffleWord_Uniform(t *testing.T) {
+	rng := New(rand.NewChaCha8([32]byte{1, 2, 3}))
+	checkShuffleUniform(t, "Shuffle", 5, 120*1000, func(data []int) {
+		rng.Shuffle(len(data), func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+	})
+}
+
+func TestShuffleWord_Positions(t *testing.T) {
+	// For n = 20, rejections happen in 7.7% of the shuffles.
+	rng := New(rand.NewPCG(1, 2))
+	for _, size := range []int{2, 8, 16, 19, 20} {
+		checkPositions(t, "Shuffle", size, 20000, func(data []int) {
+			rng.Shuffle(len(data), func(i, j int) {
+				data[i], data[j] = data[j], data[i]
+			})
+		})
+	}
+}
+
+// countingSource counts the words drawn from a source.
+type countingSource struct {
+	rand.Source
+	words int
+}
+
+func (c *countingSource) Uint64() uint64 {
+	c.words++
+	return c.Source.Uint64()
+}
+
+func TestShuffleWord_OneWord(t *testing.T) {
+	src := &countingSource{Source: rand.NewPCG(1, 2)}
+	rng := New(src)
+	for size := 0; size <= 16; size++ {
+		const numTrials = 1000
+		src.words = 0
+		for trial := 0; trial < numTrials; trial++ {
+			data := getSlice(size)
+			rng.Shuffle(size, func(i, j int) {
+				data[i], data[j] = data[j], data[i]
+			})
+			slices.Sort(data)
+			if !slices.Equal(data, getSlice(size)) {
+				t.Fatalf("size %d: result is not a permutation", size)
+			}
+		}
+		want := numTrials
+		if size < 2 {
+			want = 0
+		}
+		if src.words != want {
+			t.Errorf("size %d: %d shuffles drew %d words, expected %d", size, numTrials, src.words, want)
+		}
+	}
+}
+
+func BenchmarkWordShuffle(b *testing.B) {
+	src := rand.NewPCG(1, 2)
+	for _, size := range []int{5, 8, 12, 16, 20} {
+		data := getSlice(size)
+		swap := func(i, j int) { data[i], data[j] = data[j], data[i] }
+		b.Run(fmt.Sprintf("Word_size_%d", size), func(b *testing.B) {
+			for b.Loop() {
+				shuffleWord(src, size, swap)
+			}
+		})
+		b.Run(fmt.Sprintf("Batched_size_%d", size), func(b *testing.B) {
+			for b.Loop() {
+				shuffleLevels(src, uint64(size), batchLevels64, swap)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package batchedrand
+
+import "math/bits"
+
+// maxBatch is the largest number of indices drawn from a single random word.
+const maxBatch = 12
+
+// defaultMaxBatch is the largest batch size of Shuffle with most sources.
+// Longer batches save random words, but the chain of multiplications of a
+// batch is sequential: with PCG or ChaCha8, BenchmarkSmallShuffle measured
+// batches of up to 12 indices 10 to 50% slower than batches of up to 6 on
+// an Intel Xeon. They only paid off with the source of NewSecure, 20 to 30%
+// faster for 16 to 64 elements, where each word costs a locked read.
+const defaultMaxBatch = 6
+
+// A batchLevel tells how to draw indices while the number n of remaining
+// elements lies in (threshold, max]: k indices per random word, whose
+// ranges n, n-1, ..., n-k+1 have a product of at most bound = max^k.
+type batchLevel struct {
+	k         int
+	max       uint64
+	threshold uint64
+	bound     uint64
+}
+
+// deriveBatchLevels returns the batch levels for random words of wordBits
+// bits, in order of decreasing n, with batches of 2 to maxK indices.
+//
+// A batch of k indices is used up to max = 2^e, with e the largest integer
+// such that k*e <= wordBits-k-2. The product of the k ranges is then below
+// 2^(wordBits-k-2), so that the slow path of the rejection (a modulo) is
+// taken at most once every 2^(k+2) batches, roughly as often as the
+// single draws of rand.Shuffle take it for n near 2^62. When several batch
+// sizes share the same e, the largest is kept, and a size k is dropped
+// when max <= k, as it could never be used in full. Each level ends where
+// the next begins, and the last ends at 1.
+//
+// For 64-bit words, this gives the thresholds 2^30, 2^19, 2^14, 2^11 and
+// 2^9 (bounds 2^60, 2^57, 2^56, 2^55 and 2^54) of the batches of 2 to 6 in
+// the paper, followed, if maxK allows, by batches of 7, 8, 10 and 12.
+func deriveBatchLevels(wordBits, maxK int) []batchLevel {
+	exponent := func(k int) int {
+		return (wordBits - k - 2) / k
+	}
+	var levels []batchLevel
+	for k := 2; k <= maxK; k++ {
+		e := exponent(k)
+		if k < maxK && exponent(k+1) == e {
+			continue
+		}
+		if 1<<e <= k {
+			break
+		}
+		if len(levels) > 0 {
+			levels[len(levels)-1].threshold = 1 << e
+		}
+		levels = append(levels, batchLevel{
+			k:         k,
+			max:       1 << e,
+			threshold: 1,
+			bound:     1 << (k * e),
+		})
+	}
+	return levels
+}
+
+var (
+	// batchLevels64 drive the batched algorithm below 2^30 elements.
+	batchLevels64 = deriveBatchLevels(64, defaultMaxBatch)
+	// wideBatchLevels64 allow batches of up to maxBatch indices.
+	wideBatchLevels64 = deriveBatchLevels(64, maxBatch)
+	// batchLevels32 drive Shuffle32 below 2^14 elements.
+	batchLevels32 = deriveBatchLevels(32, defaultMaxBatch)
+)
+
+// levelBatchSize returns the number of indices drawn per random word when
+// n elements remain, according to levels.
+func levelBatchSize(levels []batchLevel, n uint64) int {
+	if n > levels[0].max {
+		return 1
+	}
+	for _, level := range levels {
+		if n > level.threshold {
+			return level.k
+		}
+	}
+	return levels[len(levels)-1].k
+}
+
+// batchSize returns the number of indices Shuffle draws per random word
+// when n elements remain, not counting the batches of 3 drawn from two
+// words above 2^30.
+func batchSize(n uint64) int {
+	return levelBatchSize(batchLevels64, n)
+}
+
+//go:generate go run ./internal/gen -o shufflelevel_gen.go
+
+// rejected reports whether the leftover of a batch of k indices for n
+// elements must be rejected.
+func rejected(n uint64, k int, leftover uint64) bool {
+	product := uint64(1)
+	for j := 0; j < k; j++ {
+		product *= n - uint64(j)
+	}
+	return leftover < (-product)%product
+}
+
+// drawBatch sets dst[j] to a uniform value in [0, n-j) for each j < k,
+// drawing a single random word from r (plus rare rejections). The product
+// n*(n-1)*...*(n-k+1) must be at most bound, itself below 2^64: rejection
+// is only possible when the leftover is below bound, so the exact (slow)
+// check is only made in that case.
+func drawBatch[S uint64Source](r S, n uint64, k int, bound uint64, dst *[maxBatch]uint64) {
+	leftover := batchIndices(n, k, r.Uint64(), dst)
+	if leftover < bound {
+		for rejected(n, k, leftover) {
+			leftover = batchIndices(n, k, r.Uint64(), dst)
+		}
+	}
+}
+
+// batchIndices sets dst[j] to the index in [0, n-j) given by the random
+// word randVal, for each j < k, and returns the leftover.
+func batchIndices(n uint64, k int, randVal uint64, dst *[maxBatch]uint64) uint64 {
+	for j := k - 1; j >= 0; j-- {
+		dst[j], randVal = bits.Mul64(n-uint64(j), randVal)
+	}
+	return randVal
+}
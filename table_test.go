@@ -0,0 +1,194 @@
+package batchedrand
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestBatchLevels_Derivation(t *testing.T) {
+	for _, tc := range []struct {
+		wordBits int
+		levels   []batchLevel
+		ks       []int
+	}{
+		{64, batchLevels64, []int{2, 3, 4, 5, 6}},
+		{64, wideBatchLevels64, []int{2, 3, 4, 5, 6, 7, 8, 10, 12}},
+		{32, batchLevels32, []int{2, 3, 4, 5, 6}},
+		{32, deriveBatchLevels(32, maxBatch), []int{2, 3, 4, 5, 6, 7}},
+	} {
+		if len(tc.levels) != len(tc.ks) {
+			t.Fatalf("%d-bit levels: %d levels, expected %d", tc.wordBits, len(tc.levels), len(tc.ks))
+		}
+		for i, level := range tc.levels {
+			if level.k != tc.ks[i] {
+				t.Errorf("%d-bit level %d: k = %d, expected %d", tc.wordBits, i, level.k, tc.ks[i])
+			}
+			// max = 2^e for the largest e with k*e <= wordBits-k-2.
+			e, k := 0, level.k
+			for k*(e+1) <= tc.wordBits-k-2 {
+				e++
+			}
+			if level.max != 1<<e {
+				t.Errorf("%d-bit k=%d: max = %d, expected 2^%d", tc.wordBits, level.k, level.max, e)
+			}
+			if level.bound != 1<<(level.k*e) {
+				t.Errorf("%d-bit k=%d: bound = %d, expected 2^%d", tc.wordBits, level.k, level.bound, level.k*e)
+			}
+			// The product of the ranges at the top of the level fits within
+			// the bound, which leaves k+2 bits to spare in a word.
+			product := big.NewInt(1)
+			for j := 0; j < level.k; j++ {
+				product.Mul(product, new(big.Int).SetUint64(level.max-uint64(j)))
+			}
+			if product.Cmp(new(big.Int).SetUint64(level.bound)) > 0 {
+				t.Errorf("%d-bit k=%d: product %v exceeds bound %d", tc.wordBits, level.k, product, level.bound)
+			}
+			if product.BitLen() > tc.wordBits-level.k-2 {
+				t.Errorf("%d-bit k=%d: product %v has %d bits", tc.wordBits, level.k, product, product.BitLen())
+			}
+			// Each level ends where the next begins.
+			threshold := uint64(1)
+			if i+1 < len(tc.levels) {
+				threshold = tc.levels[i+1].max
+			}
+			if level.threshold != threshold {
+				t.Errorf("%d-bit k=%d: threshold = %d, expected %d", tc.wordBits, level.k, level.threshold, threshold)
+			}
+			if level.max <= uint64(level.k) || level.max <= level.threshold {
+				t.Errorf("%d-bit k=%d: empty level (%d, %d]", tc.wordBits, level.k, level.threshold, level.max)
+			}
+		}
+	}
+	// The 64-bit levels for batches of 2 to 6 are those of the paper.
+	for i, want := range []batchLevel{
+		{2, 1 << 30, 1 << 19, 1 << 60},
+		{3, 1 << 19, 1 << 14, 1 << 57},
+		{4, 1 << 14, 1 << 11, 1 << 56},
+		{5, 1 << 11, 1 << 9, 1 << 55},
+		{6, 1 << 9, 1, 1 << 54},
+	} {
+		if batchLevels64[i] != want {
+			t.Errorf("64-bit level %d = %+v, expected %+v", i, batchLevels64[i], want)
+		}
+		if wide := wideBatchLevels64[i]; wide.k != want.k || wide.max != want.max || wide.bound != want.bound {
+			t.Errorf("wide 64-bit level %d = %+v, expected %+v", i, wide, want)
+		}
+	}
+}
+
+func TestDrawBatch_Uniform(t *testing.T) {
+	src := rand.NewPCG(1, 2)
+	// Every way of drawing k=7 indices for n=8 (all 8! permutations)
+	// should be equally likely.
+	const n, k = 8, 7
+	counts := make(map[[k]uint64]int)
+	const numDraws = 40320 * 50
+	var indexes [maxBatch]uint64
+	for i := 0; i < numDraws; i++ {
+		drawBatch(src, n, k, 1<<49, &indexes)
+		var key [k]uint64
+		for j := range key {
+			if indexes[j] >= n-uint64(j) {
+				t.Fatalf("index %d = %d, out of range [0, %d)", j, indexes[j], n-j)
+			}
+			key[j] = indexes[j]
+		}
+		counts[key]++
+	}
+	checkChiSquared(t, "drawBatch", counts, 40320, numDraws)
+}
+
+func TestShuffle_SmallUniform(t *testing.T) {
+	// Small sizes are shuffled with the largest batches, ending with a
+	// batch of the i-1 remaining indices.
+	for _, levels := range [][]batchLevel{batchLevels64, wideBatchLevels64} {
+		testShuffleLevels(t, levels)
+	}
+}
+
+func testShuffleLevels(t *testing.T, levels []batchLevel) {
+	src := rand.NewPCG(1, 2)
+	for _, n := range []int{2, 3, 5, 13, 17, 100} {
+		name := fmt.Sprintf("k<=%d", levels[len(levels)-1].k)
+		checkPositions(t, name, n, 20000, func(s []int) {
+			shuffleLevels(src, uint64(n), levels, func(i, j int) { s[i], s[j] = s[j], s[i] })
+		})
+	}
+}
+
+func TestShuffleSlice(t *testing.T) {
+	// The slice kernels perform the same swaps as the callback kernels,
+	// for every element type.
+	for _, size := range []int{0, 1, 5, 21, 100, 5000, dualStreamThreshold + 1001} {
+		want := getSlice(size)
+		shuffle(rand.NewPCG(1, 2), size, batchLevels64, func(i, j int) {
+			want[i], want[j] = want[j], want[i]
+		})
+		got := getSlice(size)
+		shuffleSlice(rand.NewPCG(1, 2), got, batchLevels64)
+		if !slices.Equal(got, want) {
+			t.Fatalf("size %d: slice shuffle differs from callback shuffle", size)
+		}
+		got32 := make([]uint32, size)
+		for i := range got32 {
+			got32[i] = uint32(i)
+		}
+		shuffleSlice(rand.NewPCG(1, 2), got32, batchLevels64)
+		for i, v := range got32 {
+			if int(v) != want[i] {
+				t.Fatalf("size %d: []uint32 shuffle differs from callback shuffle", size)
+			}
+		}
+	}
+}
+
+func BenchmarkSliceShuffle(b *testing.B) {
+	for _, size := range []int{100, 500000, 1 << 22} {
+		data := getSlice(size)
+		b.Run(fmt.Sprintf("Callback_size_%d", size), func(b *testing.B) {
+			src := rand.NewPCG(1, 2)
+			for b.Loop() {
+				shuffle(src, size, batchLevels64, func(i, j int) {
+					data[i], data[j] = data[j], data[i]
+				})
+			}
+		})
+		b.Run(fmt.Sprintf("Slice_size_%d", size), func(b *testing.B) {
+			src := rand.NewPCG(1, 2)
+			for b.Loop() {
+				shuffleSlice(src, data, batchLevels64)
+			}
+		})
+	}
+}
+
+func BenchmarkSmallShuffle(b *testing.B) {
+	sources := []struct {
+		name string
+		src  uint64Source
+	}{
+		{"PCG", rand.NewPCG(1, 2)},
+		{"ChaCha8", rand.NewChaCha8([32]byte{})},
+		{"Secure", &secureSource{reader: cryptorand.Reader}},
+	}
+	for _, source := range sources {
+		for _, n := range []int{16, 64, 256} {
+			s := getSlice(n)
+			swap := func(i, j int) { s[i], s[j] = s[j], s[i] }
+			b.Run(fmt.Sprintf("%s/Batched_size_%d", source.name, n), func(b *testing.B) {
+				for b.Loop() {
+					shuffleLevels(source.src, uint64(n), batchLevels64, swap)
+				}
+			})
+			b.Run(fmt.Sprintf("%s/Wide_size_%d", source.name, n), func(b *testing.B) {
+				for b.Loop() {
+					shuffleLevels(source.src, uint64(n), wideBatchLevels64, swap)
+				}
+			})
+		}
+	}
+}
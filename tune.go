@@ -0,0 +1,209 @@
+package batchedrand
+
+import (
+	"errors"
+	"math/bits"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Threshold is an entry of Thresholds: Shuffle draws batches of K indices
+// per random word while at most Max elements remain (and more than the Max
+// of the next entry).
+type Threshold struct {
+	K   int
+	Max uint64
+}
+
+// Thresholds tell Shuffle how many indices to draw from each random word,
+// in order of decreasing Max. The last entry applies down to the end of the
+// shuffle. Above the Max of the first entry, Shuffle draws batches of 3
+// indices from two words, and single indices above 2^40; up to 20
+// elements, it draws the whole permutation from a single word.
+//
+// The defaults were measured on a few machines only. Tune measures the
+// best thresholds for a source on the current machine, and their text
+// form (see MarshalText) lets deployments store and reuse them.
+type Thresholds []Threshold
+
+// Errors returned by Thresholds.Validate.
+var (
+	errThresholdsEmpty    = errors.New("invalid thresholds: no entry")
+	errThresholdsBatch    = errors.New("invalid thresholds: K must be between 1 and 12")
+	errThresholdsOrder    = errors.New("invalid thresholds: Max must decrease, and exceed K")
+	errThresholdsOverflow = errors.New("invalid thresholds: product of the ranges of a batch exceeds 64 bits")
+	errThresholdsSyntax   = errors.New("invalid thresholds encoding")
+)
+
+// DefaultThresholds returns the thresholds Shuffle uses with most sources.
+func DefaultThresholds() Thresholds {
+	return levelThresholds(batchLevels64)
+}
+
+// levelThresholds returns the thresholds of levels.
+func levelThresholds(levels []batchLevel) Thresholds {
+	t := make(Thresholds, len(levels))
+	for i, level := range levels {
+		t[i] = Threshold{K: level.k, Max: level.max}
+	}
+	return t
+}
+
+// Validate reports whether Shuffle can use t: each batch must have between
+// 1 and 12 indices, the maxima must decrease and exceed the batch sizes,
+// and the product of the K ranges of a batch, up to Max*(Max-1)*...*
+// (Max-K+1), must fit in 64 bits, lest the batches be biased.
+func (t Thresholds) Validate() error {
+	_, err := t.levels()
+	return err
+}
+
+// levels converts t to batch levels, with the exact product at Max as
+// bound.
+func (t Thresholds) levels() ([]batchLevel, error) {
+	if len(t) == 0 {
+		return nil, errThresholdsEmpty
+	}
+	levels := make([]batchLevel, len(t))
+	for i, th := range t {
+		if th.K < 1 || th.K > maxBatch {
+			return nil, errThresholdsBatch
+		}
+		if th.Max <= uint64(th.K) || (i > 0 && th.Max >= t[i-1].Max) {
+			return nil, errThresholdsOrder
+		}
+		bound := uint64(1)
+		for j := 0; j < th.K; j++ {
+			hi, lo := bits.Mul64(bound, th.Max-uint64(j))
+			if hi != 0 {
+				return nil, errThresholdsOverflow
+			}
+			bound = lo
+		}
+		levels[i] = batchLevel{k: th.K, max: th.Max, threshold: 1, bound: bound}
+		if i > 0 {
+			levels[i-1].threshold = th.Max
+		}
+	}
+	return levels, nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. The text
+// form lists K:Max pairs separated by commas, such as "2:1073741824,3:524288".
+func (t Thresholds) MarshalText() ([]byte, error) {
+	var b []byte
+	for i, th := range t {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendInt(b, int64(th.K), 10)
+		b = append(b, ':')
+		b = strconv.AppendUint(b, th.Max, 10)
+	}
+	return b, nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. It
+// rejects thresholds that do not pass Validate.
+func (t *Thresholds) UnmarshalText(text []byte) error {
+	var parsed Thresholds
+	for _, field := range strings.Split(string(text), ",") {
+		kText, maxText, ok := strings.Cut(field, ":")
+		if !ok {
+			return errThresholdsSyntax
+		}
+		k, err := strconv.Atoi(kText)
+		if err != nil {
+			return errThresholdsSyntax
+		}
+		limit, err := strconv.ParseUint(maxText, 10, 64)
+		if err != nil {
+			return errThresholdsSyntax
+		}
+		parsed = append(parsed, Threshold{K: k, Max: limit})
+	}
+	if err := parsed.Validate(); err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// SetThresholds makes Shuffle use t, which must pass Validate, instead of
+// the defaults. A nil t restores the defaults. SetThresholds must not be
+// called concurrently with other methods of r, even for a Rand returned by
+// NewSecure: set the thresholds before sharing r.
+func (r *Rand) SetThresholds(t Thresholds) error {
+	if t == nil {
+		r.levels = nil
+		return nil
+	}
+	levels, err := t.levels()
+	if err != nil {
+		return err
+	}
+	r.levels = levels
+	return nil
+}
+
+// Thresholds returns the thresholds Shuffle uses.
+func (r *Rand) Thresholds() Thresholds {
+	_, levels := r.shuffleSource()
+	return levelThresholds(levels)
+}
+
+const (
+	// tuneMinSize and tuneMaxSize delimit the sizes that Tune measures:
+	// below, Shuffle draws whole permutations from single words, and
+	// above, only batches of 2 and 3 fit in 64 bits.
+	tuneMinSize = 1 << 5
+	tuneMaxSize = 1 << 20
+	// tuneMinSwaps is the number of swaps timed for each measurement.
+	tuneMinSwaps = 1 << 14
+	// tuneRounds is the number of measurements of which the best is kept.
+	tuneRounds = 3
+)
+
+// Tune measures, on the current machine, how many indices Shuffle should
+// draw from each word of src, and returns the corresponding thresholds,
+// for use with SetThresholds. For each range of sizes (2^(s-1), 2^s] up to
+// 2^20, it times the batch sizes whose products fit in 64 bits, and keeps
+// the fastest; larger sizes keep batches of 2. Tune takes a fraction of a
+// second, and consumes words of src. Its result, depending on timings,
+// varies from run to run: store it rather than tuning at each start.
+func Tune(src rand.Source) Thresholds {
+	data := make([]int, tuneMaxSize)
+	for i := range data {
+		data[i] = i
+	}
+	swap := func(i, j int) { data[i], data[j] = data[j], data[i] }
+	t := Thresholds{{K: 2, Max: batchLevels64[0].max}}
+	for size := uint64(tuneMaxSize); size >= tuneMinSize; size /= 2 {
+		bestK, best := 0, time.Duration(0)
+		for k := 2; k <= maxBatch; k++ {
+			level, err := Thresholds{{K: k, Max: size}, {K: 1, Max: size / 2}}.levels()
+			if err != nil {
+				break // larger batches overflow too
+			}
+			var elapsed time.Duration
+			for round := 0; round < tuneRounds; round++ {
+				start := time.Now()
+				for swaps := uint64(0); swaps < tuneMinSwaps; swaps += size / 2 {
+					shuffleLevels(src, size, level[:1], swap)
+				}
+				if d := time.Since(start); round == 0 || d < elapsed {
+					elapsed = d
+				}
+			}
+			if bestK == 0 || elapsed < best {
+				bestK, best = k, elapsed
+			}
+		}
+		if t[len(t)-1].K != bestK {
+			t = append(t, Threshold{K: bestK, Max: size})
+		}
+	}
+	return t
+}
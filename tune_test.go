@@ -0,0 +1,141 @@
+package batchedrand
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestThresholds_Validate(t *testing.T) {
+	for _, valid := range []Thresholds{
+		DefaultThresholds(),
+		levelThresholds(wideBatchLevels64),
+		{{K: 1, Max: 1 << 40}},
+		{{K: 2, Max: 1 << 32}},
+		{{K: 3, Max: 1 << 21}, {K: 12, Max: 13}},
+	} {
+		if err := valid.Validate(); err != nil {
+			t.Errorf("%v: %v", valid, err)
+		}
+	}
+	for _, tc := range []struct {
+		t    Thresholds
+		want error
+	}{
+		{nil, errThresholdsEmpty},
+		{Thresholds{{K: 0, Max: 10}}, errThresholdsBatch},
+		{Thresholds{{K: 13, Max: 20}}, errThresholdsBatch},
+		{Thresholds{{K: 2, Max: 100}, {K: 3, Max: 100}}, errThresholdsOrder},
+		{Thresholds{{K: 2, Max: 100}, {K: 3, Max: 200}}, errThresholdsOrder},
+		{Thresholds{{K: 6, Max: 6}}, errThresholdsOrder},
+		{Thresholds{{K: 2, Max: 1<<32 + 1}}, errThresholdsOverflow},
+		{Thresholds{{K: 2, Max: 1 << 30}, {K: 4, Max: 1 << 17}}, errThresholdsOverflow},
+	} {
+		if err := tc.t.Validate(); err != tc.want {
+			t.Errorf("%v: got %v, expected %v", tc.t, err, tc.want)
+		}
+	}
+}
+
+func TestThresholds_Text(t *testing.T) {
+	want := Thresholds{{K: 2, Max: 1 << 30}, {K: 3, Max: 1 << 19}, {K: 7, Max: 100}}
+	text, err := want.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "2:1073741824,3:524288,7:100" {
+		t.Errorf("MarshalText = %q", text)
+	}
+	var got Thresholds
+	if err := got.UnmarshalText(text); err != nil || !slices.Equal(got, want) {
+		t.Errorf("UnmarshalText(%q) = %v, %v; expected %v", text, got, err, want)
+	}
+
+	// As an encoding.TextMarshaler, Thresholds encode to a JSON string.
+	data, err := json.Marshal(map[string]Thresholds{"pcg": want})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]Thresholds
+	if err := json.Unmarshal(data, &decoded); err != nil || !slices.Equal(decoded["pcg"], want) {
+		t.Errorf("JSON round trip of %s = %v, %v", data, decoded, err)
+	}
+
+	for _, bad := range []string{"", "2", "2:", "x:10", "2:-1", "2:10,", "2:10;3:5", "3:10,2:20", "2:4294967297"} {
+		got := Thresholds{{K: 5, Max: 50}}
+		if err := got.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("UnmarshalText(%q) succeeded", bad)
+		}
+		if len(got) != 1 || got[0] != (Threshold{K: 5, Max: 50}) {
+			t.Errorf("UnmarshalText(%q) modified the thresholds to %v", bad, got)
+		}
+	}
+}
+
+func TestSetThresholds(t *testing.T) {
+	rng := New(rand.NewPCG(1, 2))
+	if got := rng.Thresholds(); !slices.Equal(got, DefaultThresholds()) {
+		t.Errorf("Thresholds() = %v, expected the defaults", got)
+	}
+	if got := NewSecure().Thresholds(); !slices.Equal(got, levelThresholds(wideBatchLevels64)) {
+		t.Errorf("secure Thresholds() = %v, expected batches of up to 12", got)
+	}
+	if err := rng.SetThresholds(Thresholds{{K: 2, Max: 1 << 40}}); err == nil {
+		t.Errorf("SetThresholds accepted an overflowing batch")
+	}
+	for _, custom := range []Thresholds{
+		{{K: 1, Max: 1 << 30}},
+		{{K: 3, Max: 1 << 21}, {K: 7, Max: 64}},
+		{{K: 2, Max: 1 << 30}, {K: 12, Max: 40}, {K: 4, Max: 30}, {K: 1, Max: 5}},
+	} {
+		if err := rng.SetThresholds(custom); err != nil {
+			t.Fatal(err)
+		}
+		if got := rng.Thresholds(); !slices.Equal(got, custom) {
+			t.Errorf("Thresholds() = %v, expected %v", got, custom)
+		}
+		for _, size := range []int{25, 37, 100} {
+			checkPositions(t, fmt.Sprint(custom), size, 20000, func(data []int) {
+				rng.Shuffle(len(data), func(i, j int) {
+					data[i], data[j] = data[j], data[i]
+				})
+			})
+		}
+	}
+	if err := rng.SetThresholds(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := rng.Thresholds(); !slices.Equal(got, DefaultThresholds()) {
+		t.Errorf("Thresholds() = %v after a reset, expected the defaults", got)
+	}
+}
+
+func TestTune(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing measurements in short mode")
+	}
+	for _, src := range []rand.Source{rand.NewPCG(1, 2), rand.NewChaCha8([32]byte{})} {
+		tuned := Tune(src)
+		if err := tuned.Validate(); err != nil {
+			t.Fatalf("Tune returned %v: %v", tuned, err)
+		}
+		if tuned[0] != (Threshold{K: 2, Max: 1 << 30}) {
+			t.Errorf("Tune returned %v, expected batches of 2 up to 2^30", tuned)
+		}
+		rng := New(src)
+		if err := rng.SetThresholds(tuned); err != nil {
+			t.Fatal(err)
+		}
+		data := getSlice(1000)
+		rng.Shuffle(len(data), func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+		slices.Sort(data)
+		if !slices.Equal(data, getSlice(1000)) {
+			t.Fatalf("result is not a permutation")
+		}
+		t.Logf("%T: %v", src, tuned)
+	}
+}
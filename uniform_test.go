@@ -0,0 +1,74 @@
+package batchedrand
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// checkChiSquared checks that the counts of numTrials trials are spread
+// uniformly over cells outcomes.
+func checkChiSquared[K comparable](t *testing.T, name string, counts map[K]int, cells, numTrials int) {
+	t.Helper()
+	if len(counts) != cells {
+		t.Fatalf("%s: saw %d outcomes, expected %d", name, len(counts), cells)
+	}
+	expected := float64(numTrials) / float64(cells)
+	chi2 := 0.0
+	for _, c := range counts {
+		d := float64(c) - expected
+		chi2 += d * d / expected
+	}
+	// The chi-squared statistic has a mean of cells-1 and a standard
+	// deviation close to sqrt(2*cells).
+	if limit := float64(cells) + 5*math.Sqrt(2*float64(cells)); chi2 > limit {
+		t.Errorf("%s: chi-squared = %.0f, above %.0f", name, chi2, limit)
+	}
+}
+
+// checkUniform checks that the numTrials permutations of draw take numPerms
+// values, uniformly.
+func checkUniform(t *testing.T, name string, numPerms, numTrials int, draw func() Permutation) {
+	t.Helper()
+	counts := make(map[string]int)
+	for trial := 0; trial < numTrials; trial++ {
+		counts[fmt.Sprint(draw())]++
+	}
+	checkChiSquared(t, name, counts, numPerms, numTrials)
+}
+
+// checkShuffleUniform checks that numTrials shuffles of 0, 1, ..., size-1
+// give the size! permutations, uniformly.
+func checkShuffleUniform(t *testing.T, name string, size, numTrials int, shuffle func(data []int)) {
+	t.Helper()
+	checkUniform(t, name, int(factorials[size]), numTrials, func() Permutation {
+		data := getSlice(size)
+		shuffle(data)
+		return data
+	})
+}
+
+// checkPositions checks that numTrials shuffles of 0, 1, ..., size-1 put
+// every value at every position, uniformly.
+func checkPositions(t *testing.T, name string, size, numTrials int, shuffle func(data []int)) {
+	t.Helper()
+	counts := make([][]int, size)
+	for i := range counts {
+		counts[i] = make([]int, size)
+	}
+	for trial := 0; trial < numTrials; trial++ {
+		data := getSlice(size)
+		shuffle(data)
+		for pos, v := range data {
+			counts[v][pos]++
+		}
+	}
+	expected := float64(numTrials) / float64(size)
+	for v := range counts {
+		for pos, c := range counts[v] {
+			if d := float64(c) - expected; d*d > 25*expected {
+				t.Errorf("%s, size %d: %d at position %d %d times, expected about %.0f", name, size, v, pos, c, expected)
+			}
+		}
+	}
+}